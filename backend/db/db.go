@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -14,7 +16,8 @@ import (
 
 var DB *gorm.DB
 
-func Init() {
+// DSN 由環境變數組出 Postgres 連線字串（Init 與 LISTEN 專用連線共用）
+func DSN() string {
 	dbHost := os.Getenv("DB_HOST")
 	dbUser := os.Getenv("DB_USER")
 	dbPassword := os.Getenv("DB_PASSWORD")
@@ -22,15 +25,27 @@ func Init() {
 	dbPort := os.Getenv("DB_PORT")
 	dbTimeZone := os.Getenv("DB_TIMEZONE")
 
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=%s",
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=%s",
 		dbHost, dbUser, dbPassword, dbName, dbPort, dbTimeZone)
+}
+
+func Init() {
+	dsn := DSN()
 
 	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// TranslateError 讓唯一鍵衝突回傳 gorm.ErrDuplicatedKey
+	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// growth_data.timestamp 舊版為 RFC3339 字串，需在 AutoMigrate 前轉為 timestamptz
+	migrateGrowthTimestamp()
+	// summaries 舊版每次讀取都新增/覆寫一列，改為每天一筆快照
+	migrateSummaryHistory()
+	// map_records 加上 (map_name, difficulty) 唯一鍵前需先處理重複的地圖
+	migrateMapRecordDuplicates()
+
 	// 自動遷移 Schema
 	DB.AutoMigrate(
 		&model.Summary{},
@@ -38,8 +53,13 @@ func Init() {
 		&model.MapRecord{},
 		&model.GrowthData{},
 		&model.Message{},
+		&model.Presence{},
+		&model.MapTransition{},
 	)
 
+	// 地圖搜尋的 trigram 索引
+	migrateSearchIndex()
+
 	// 移除 players 表的舊積分欄位（如已存在）
 	migrator := DB.Migrator()
 	for _, col := range []string{"score_contribution", "map_count", "contribution_rate"} {
@@ -51,6 +71,177 @@ func Init() {
 	log.Println("Database connected and migrated.")
 }
 
+// migrateGrowthTimestamp 將 growth_data.timestamp 由 text 轉為 timestamptz（僅執行一次）
+func migrateGrowthTimestamp() {
+	migrator := DB.Migrator()
+	if !migrator.HasColumn(&model.GrowthData{}, "timestamp") {
+		return
+	}
+
+	columnTypes, err := migrator.ColumnTypes(&model.GrowthData{})
+	if err != nil {
+		log.Println("Failed to inspect growth_data columns:", err)
+		return
+	}
+
+	for _, ct := range columnTypes {
+		if ct.Name() != "timestamp" {
+			continue
+		}
+		switch strings.ToLower(ct.DatabaseTypeName()) {
+		case "text", "varchar", "character varying":
+			err := DB.Exec(`ALTER TABLE growth_data ALTER COLUMN "timestamp" TYPE timestamptz USING NULLIF("timestamp", '')::timestamptz`).Error
+			if err != nil {
+				log.Fatal("Failed to migrate growth_data.timestamp:", err)
+			}
+			log.Println("Migrated growth_data.timestamp to timestamptz.")
+		}
+	}
+}
+
+// migrateSummaryHistory 為 summaries 補上 date 欄位並保留每天最後一筆（僅執行一次）
+func migrateSummaryHistory() {
+	migrator := DB.Migrator()
+	if !migrator.HasTable(&model.Summary{}) || migrator.HasColumn(&model.Summary{}, "date") {
+		return
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`ALTER TABLE summaries ADD COLUMN date varchar(10)`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE summaries SET date = TO_CHAR(last_update, 'YYYY-MM-DD')`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`DELETE FROM summaries s USING summaries t WHERE s.date = t.date AND s.id < t.id`).Error
+	})
+	if err != nil {
+		log.Fatal("Failed to migrate summaries.date:", err)
+	}
+	log.Println("Migrated summaries to daily snapshots.")
+}
+
+// mapRecordUniqueIndex 為 map_records (map_name, difficulty) 唯一鍵的名稱
+const mapRecordUniqueIndex = "idx_map_records_map_difficulty"
+
+// migrateMapRecordDuplicates 在建立 (map_name, difficulty) 唯一鍵前處理重複的地圖：
+// 沒有任何進度的重複記錄（未完成、沒有 runner / note / 狀態歷史）直接移除；
+// 其餘的重複不自動刪除，而是列出 ID 並先建立同名的部分唯一索引（排除每組除了
+// ID 最小者以外的舊重複記錄），讓服務照常啟動、同時擋下新的重複。
+// 管理員以 POST /api/admin/maps/:id/merge 合併後，下次啟動時才改為完整的唯一鍵。
+func migrateMapRecordDuplicates() {
+	migrator := DB.Migrator()
+	if !migrator.HasTable(&model.MapRecord{}) {
+		return
+	}
+	placeholder := false
+	if migrator.HasIndex(&model.MapRecord{}, mapRecordUniqueIndex) {
+		var complete bool
+		err := DB.Raw(`SELECT i.indisunique AND i.indpred IS NULL FROM pg_index i
+			JOIN pg_class c ON c.oid = i.indexrelid WHERE c.relname = ?`, mapRecordUniqueIndex).Scan(&complete).Error
+		if err != nil {
+			log.Fatal("Failed to inspect map_records indexes:", err)
+		}
+		if complete {
+			return
+		}
+		placeholder = true
+	}
+
+	untouched := `m.status = 0 AND COALESCE(m.runner, '') = '' AND COALESCE(m.note, '') = ''`
+	played := `(o.status <> 0 OR COALESCE(o.runner, '') <> '' OR COALESCE(o.note, '') <> '')`
+	if migrator.HasTable(&model.MapTransition{}) {
+		untouched += ` AND NOT EXISTS (SELECT 1 FROM map_transitions t WHERE t.map_record_id = m.id)`
+		played = `(` + played + ` OR EXISTS (SELECT 1 FROM map_transitions t WHERE t.map_record_id = o.id))`
+	}
+	// 同一組內保留有進度的記錄；全都沒有進度時保留 ID 最小的一筆
+	result := DB.Exec(`DELETE FROM map_records m WHERE ` + untouched + ` AND EXISTS (
+		SELECT 1 FROM map_records o
+		WHERE o.map_name = m.map_name AND o.difficulty = m.difficulty AND o.id <> m.id
+			AND (o.id < m.id OR ` + played + `))`)
+	if result.Error != nil {
+		log.Fatal("Failed to remove untouched duplicate map_records:", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Removed %d untouched duplicate map_records.", result.RowsAffected)
+	}
+
+	var conflicts []struct {
+		MapName    string
+		Difficulty string
+		IDs        string `gorm:"column:ids"`
+	}
+	err := DB.Raw(`SELECT map_name, difficulty, STRING_AGG(id::text, ', ' ORDER BY id) AS ids
+		FROM map_records GROUP BY map_name, difficulty HAVING COUNT(*) > 1
+		ORDER BY map_name, difficulty`).Scan(&conflicts).Error
+	if err != nil {
+		log.Fatal("Failed to find duplicate map_records:", err)
+	}
+
+	if len(conflicts) == 0 {
+		// 重複已全部合併：移除暫用的部分索引，交給 AutoMigrate 建立唯一鍵
+		if placeholder {
+			if err := migrator.DropIndex(&model.MapRecord{}, mapRecordUniqueIndex); err != nil {
+				log.Fatal("Failed to drop the temporary map_records index:", err)
+			}
+		}
+		return
+	}
+
+	for _, c := range conflicts {
+		log.Printf("Duplicate map_records for %s (%s): ids %s", c.MapName, c.Difficulty, c.IDs)
+	}
+	log.Printf("%d maps have duplicate records with progress; merge them with POST /api/admin/maps/:id/merge. "+
+		"The (map_name, difficulty) unique index is created on the next start once none remain.", len(conflicts))
+
+	// 每組保留 ID 最小的一筆在索引內，新的記錄（含與待合併地圖同名同難度者）都會被擋下
+	var legacy []uint
+	err = DB.Raw(`SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY map_name, difficulty ORDER BY id) AS n FROM map_records
+		) r WHERE n > 1 ORDER BY id`).Scan(&legacy).Error
+	if err != nil {
+		log.Fatal("Failed to list duplicate map_records:", err)
+	}
+	ids := make([]string, len(legacy))
+	for i, id := range legacy {
+		ids[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if placeholder {
+			if err := tx.Exec(`DROP INDEX ` + mapRecordUniqueIndex).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec(`CREATE UNIQUE INDEX ` + mapRecordUniqueIndex + ` ON map_records (map_name, difficulty)
+			WHERE id NOT IN (` + strings.Join(ids, ", ") + `)`).Error
+	})
+	if err != nil {
+		log.Fatal("Failed to create the temporary map_records index:", err)
+	}
+}
+
+// MapSearchDocument 為地圖搜尋預先篩選用的 SQL 運算式：地圖名稱、作者、runner 與備註
+// 轉小寫並去除常見的拉丁字母變音符號（近似 service.normalizeSearch）。
+// 查詢需使用完全相同的運算式才會用到 migrateSearchIndex 建立的索引。
+const MapSearchDocument = `translate(lower(COALESCE(map_name, '') || ' ' || COALESCE(mapper, '') || ' ' ||
+	COALESCE(runner, '') || ' ' || COALESCE(note, '')),
+	'àáâãäåāăąçćčďèéêëēėęěìíîïīįñńňòóôõöōőřśšşťùúûüūůűųýÿžźż',
+	'aaaaaaaaacccdeeeeeeeeiiiiiinnnooooooorssstuuuuuuuuyyzzz')`
+
+// migrateSearchIndex 以 pg_trgm 為 MapSearchDocument 建立 GIN 索引，讓 LIKE '%...%' 可使用索引；
+// 沒有權限建立 extension 時搜尋仍可使用，只是預先篩選改為循序掃描
+func migrateSearchIndex() {
+	if err := DB.Exec(`CREATE EXTENSION IF NOT EXISTS pg_trgm`).Error; err != nil {
+		log.Println("pg_trgm is unavailable, map search runs without an index:", err)
+		return
+	}
+	err := DB.Exec(`CREATE INDEX IF NOT EXISTS idx_map_records_search ON map_records USING gin ((` +
+		MapSearchDocument + `) gin_trgm_ops)`).Error
+	if err != nil {
+		log.Println("Failed to create the map search index:", err)
+	}
+}
+
 // GetDB 提供給其他 package 使用
 func GetDB() *gorm.DB {
 	return DB
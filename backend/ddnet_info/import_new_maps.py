@@ -65,27 +65,30 @@ def main():
                 star_val = int(parts[0])
 
                 map_name = parts[1].strip()
+                mapper = parts[2].strip() if len(parts) >= 3 else ''
                 points_val = calculate_points(star_val)
                 
                 file_map_data[map_name] = {
                     'points': points_val,
-                    'stars': star_val
+                    'stars': star_val,
+                    'mapper': mapper
                 }
 
         to_insert = []
         to_update = []
         
-        cursor.execute("SELECT map_name FROM map_records")
-        db_maps = {row[0] for row in cursor.fetchall()}
+        # 同名地圖可能出現在不同難度，必須以 (map_name, difficulty) 比對
+        cursor.execute("SELECT map_name, difficulty FROM map_records")
+        db_maps = {(row[0], row[1]) for row in cursor.fetchall()}
 
 
         for name, data in file_map_data.items():
-            if name not in db_maps:
+            if (name, TARGET_DIFFICULTY) not in db_maps:
                 # 新增地圖時，還是會寫入初始星級與分數
-                to_insert.append((TARGET_DIFFICULTY, name, data['stars'], data['points']))
+                to_insert.append((TARGET_DIFFICULTY, name, data['stars'], data['points'], data['mapper']))
             else:
-                # ★ 修改處：更新現有地圖時，只放入 stars，不放 points
-                to_update.append((data['stars'], name))
+                # ★ 修改處：更新現有地圖時，只放入 stars 與 mapper，不放 points
+                to_update.append((data['stars'], data['mapper'], name, TARGET_DIFFICULTY))
 
         # 執行新增
         if to_insert:
@@ -93,8 +96,8 @@ def main():
             print(f"🚀 正在新增 {len(to_insert)} 張新地圖...")
             insert_query = """
             INSERT INTO map_records 
-            (difficulty, map_name, stars, runner, points, score, note, status) 
-            VALUES (%s, %s, %s, '', %s, 0, '', 0)
+            (difficulty, map_name, stars, runner, points, score, note, status, mapper) 
+            VALUES (%s, %s, %s, '', %s, 0, '', 0, %s)
             """
             cursor.executemany(insert_query, to_insert)
 
@@ -105,8 +108,8 @@ def main():
             # ★ 修改處：SQL 語句移除 points = %s
             update_query = """
             UPDATE map_records 
-            SET stars = %s 
-            WHERE map_name = %s
+            SET stars = %s, mapper = %s 
+            WHERE map_name = %s AND difficulty = %s
             """
             cursor.executemany(update_query, to_update)
 
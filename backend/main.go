@@ -23,7 +23,15 @@ func main() {
 	// 3. 啟動時更新一次全服總覽 (Optional, 視需求)
 	service.UpdateGlobalSummary()
 
-	// 4. 初始化路由並啟動 Server
+	// 4. 監聽其他實例的寫入通知 (Postgres LISTEN/NOTIFY)，轉發給本機 SSE 客戶端
+	service.StartNotifyListener()
+
+	// 5. 定期清除過期的 presence（正在玩的地圖）與到期的地圖預約，並檢查排行榜索引是否與 DB 一致
+	service.StartPresenceSweeper()
+	service.StartClaimSweeper()
+	service.StartLeaderboardChecker()
+
+	// 6. 初始化路由並啟動 Server
 	r := router.InitRouter()
 
 	r.Run(":8080")
@@ -1,12 +1,23 @@
 package model
 
+import "time"
+
 type GrowthData struct {
-	ID        uint    `gorm:"primaryKey" json:"id"`
-	Hours     float64 `json:"hours"`
-	Points    int     `json:"points"`
-	Runner    string  `json:"runner"`
-	MapName   string  `json:"map_name"`
-	MapPoints int     `json:"map_points"`
-	Maps      int     `json:"maps"`
-	Timestamp string  `json:"timestamp"`
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Hours     float64   `json:"hours"`
+	Points    int       `json:"points"`
+	Runner    string    `json:"runner"`
+	MapName   string    `json:"map_name"`
+	MapPoints int       `json:"map_points"`
+	Maps      int       `json:"maps"`
+	Timestamp time.Time `gorm:"type:timestamptz;index" json:"timestamp"`
+}
+
+// GrowthBucket 為 GrowthData 依時間區間 (hour/day/week) 降採樣後的結果
+type GrowthBucket struct {
+	Timestamp time.Time `json:"timestamp"`
+	Hours     float64   `json:"hours"`
+	Points    int       `json:"points"`
+	Maps      int       `json:"maps"`
+	Count     int       `json:"count"`
 }
@@ -1,47 +1,165 @@
 package model
 
 import (
-	"gorm.io/gorm"
+	"errors"
+	"fmt"
+	"slices"
 	"time"
 )
 
 type MapRecord struct {
 	ID         uint       `gorm:"primaryKey" json:"id"`
-	Difficulty string     `json:"difficulty"`
-	MapName    string     `json:"map_name"`
+	Difficulty string     `gorm:"uniqueIndex:idx_map_records_map_difficulty,priority:2" json:"difficulty"`
+	MapName    string     `gorm:"uniqueIndex:idx_map_records_map_difficulty,priority:1" json:"map_name"`
 	Runner     string     `json:"runner"`
 	Score      int        `json:"score"`
 	Points     int        `json:"points"`
 	Stars      int        `json:"stars"`
 	Note       string     `json:"note"`
-	Status     int        `json:"status"` // 0:未完成, 1:進行中, 2:已完成, 3:已加載
+	Mapper     string     `json:"mapper"` // 作者（由 ddnet_info 匯入）
+	Status     int        `json:"status"` // 見 Status* 常數，只能透過 Transition 變更
 	FinishTime *time.Time `gorm:"column:finish_time" json:"finish_time"`
 
 	HasDummy bool `gorm:"column:has_dummy" json:"has_dummy"`
+
+	// Retired 的地圖不計入總覽與進度的目標，也不能再預約或完成（歷史紀錄保留）
+	Retired bool `gorm:"not null;default:false" json:"retired"`
+
+	// Version 每次寫入遞增，用於 If-Match 樂觀鎖（ETag 為 "<version>"）
+	Version int `gorm:"not null;default:1" json:"version"`
+
+	// 預約 (status 1) 的開始與到期時間；Runner 為預約者，到期未續約即自動釋放
+	ClaimedAt      *time.Time `gorm:"column:claimed_at" json:"claimed_at"`
+	ClaimExpiresAt *time.Time `gorm:"column:claim_expires_at;index" json:"claim_expires_at"`
+}
+
+// Map lifecycle states (MapRecord.Status)
+const (
+	StatusUnplayed  = 0 // 未完成
+	StatusWIP       = 1 // 進行中（預約）
+	StatusCompleted = 2 // 已完成
+	StatusLoaded    = 3 // 已加載（以存檔完成，不計入完成數）
+	StatusVerified  = 4 // 已驗證
+)
+
+// CompletedStatuses 為計入完成數與分數的狀態
+var CompletedStatuses = []int{StatusCompleted, StatusVerified}
+
+// Difficulties 為已知的難度分類（與前端 CATEGORIES 相同）
+var Difficulties = []string{
+	"NOVICE", "MODERATE", "BRUTAL", "INSANE",
+	"DUMMY", "SOLO", "RACE", "OLDSCHOOL",
+	"DDMAX.EASY", "DDMAX.NEXT", "DDMAX.PRO", "DDMAX.NUT",
+	"EVENT", "FUN",
+}
+
+// IsKnownDifficulty 判斷難度是否在 Difficulties 中
+func IsKnownDifficulty(difficulty string) bool {
+	return slices.Contains(Difficulties, difficulty)
+}
+
+// IsCompleted 判斷狀態是否計入完成
+func IsCompleted(status int) bool {
+	return slices.Contains(CompletedStatuses, status)
 }
 
-// BeforeSave Hook
-func (m *MapRecord) BeforeSave(tx *gorm.DB) error {
-	if m.Runner == "" || m.Runner == "-" || m.Runner == "nan" {
-		m.Status = 0
-	} else if m.Status == 1 {
-		// 明確指定為 WIP (1) 時保持原樣
-	} else if m.Score > 0 {
+// Map lifecycle actions
+const (
+	ActionClaim    = "claim"    // unplayed/wip → wip
+	ActionRelease  = "release"  // wip → unplayed
+	ActionComplete = "complete" // unplayed/wip/loaded → completed
+	ActionLoad     = "load"     // unplayed/wip → loaded
+	ActionVerify   = "verify"   // completed → verified
+	ActionRevert   = "revert"   // completed/verified/loaded → unplayed
 
-		m.Status = 2
-	} else {
+	// ActionMerge 只由管理員合併重複地圖時寫入（不經 Transition）
+	ActionMerge = "merge"
+)
+
+type transitionRule struct {
+	from []int
+	to   int
+}
+
+var transitionRules = map[string]transitionRule{
+	ActionClaim:    {from: []int{StatusUnplayed, StatusWIP}, to: StatusWIP},
+	ActionRelease:  {from: []int{StatusWIP}, to: StatusUnplayed},
+	ActionComplete: {from: []int{StatusUnplayed, StatusWIP, StatusLoaded}, to: StatusCompleted},
+	ActionLoad:     {from: []int{StatusUnplayed, StatusWIP}, to: StatusLoaded},
+	ActionVerify:   {from: []int{StatusCompleted}, to: StatusVerified},
+	ActionRevert:   {from: []int{StatusCompleted, StatusVerified, StatusLoaded}, to: StatusUnplayed},
+}
+
+var (
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrRunnerRequired    = errors.New("runner is required")
+	ErrMapRetired        = errors.New("map is retired")
+)
+
+// MapTransition 為 MapRecord 狀態變更的紀錄
+type MapTransition struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	MapRecordID uint      `gorm:"index" json:"map_record_id"`
+	Action      string    `json:"action"`
+	FromStatus  int       `json:"from_status"`
+	ToStatus    int       `json:"to_status"`
+	Runner      string    `json:"runner"` // 執行這次變更的 runner（見 Transition）
+	CreatedAt   time.Time `json:"created_at"`
+}
 
-		m.Status = 1
+// Transition 驗證並套用狀態變更，回傳要寫入的 MapTransition（呼叫端需與記錄一併儲存）。
+// runner 為 claim/complete/load 的執行者；complete 未帶分數時以地圖 Points 計分。
+func (m *MapRecord) Transition(action string, runner string, now time.Time) (MapTransition, error) {
+	rule, ok := transitionRules[action]
+	if !ok || !slices.Contains(rule.from, m.Status) {
+		return MapTransition{}, fmt.Errorf("%w: cannot %s a map in status %d", ErrInvalidTransition, action, m.Status)
 	}
 
-	if m.Status == 2 && m.Score == 0 && m.Points > 0 {
-		m.Score = m.Points
+	switch action {
+	case ActionClaim, ActionComplete, ActionLoad:
+		if m.Retired {
+			return MapTransition{}, ErrMapRetired
+		}
+		if runner == "" {
+			return MapTransition{}, ErrRunnerRequired
+		}
+		m.Runner = runner
 	}
 
-	if m.Status == 2 && m.FinishTime == nil {
-		now := time.Now()
+	// actingRunner 為執行這次變更的 runner：claim/complete/load 是新的執行者，
+	// release/revert/verify 是變更前的執行者（還原時 m.Runner 會被清空）
+	from, actingRunner := m.Status, m.Runner
+	m.Status = rule.to
+
+	switch rule.to {
+	case StatusWIP:
+		if from != StatusWIP || m.ClaimedAt == nil {
+			m.ClaimedAt = &now
+		}
+	case StatusCompleted:
+		if m.Score == 0 {
+			m.Score = m.Points
+		}
+		m.FinishTime = &now
+	case StatusLoaded:
 		m.FinishTime = &now
+	case StatusUnplayed:
+		m.Runner = ""
+		m.Score = 0
+		m.FinishTime = nil
+		m.HasDummy = false
+	}
+	if m.Status != StatusWIP {
+		m.ClaimedAt = nil
+		m.ClaimExpiresAt = nil
 	}
 
-	return nil
+	return MapTransition{
+		MapRecordID: m.ID,
+		Action:      action,
+		FromStatus:  from,
+		ToStatus:    m.Status,
+		Runner:      actingRunner,
+		CreatedAt:   now,
+	}, nil
 }
@@ -13,4 +13,16 @@ type PlayerStats struct {
 	Role              string  `json:"role"`
 	ScoreContribution float64 `json:"score_contrib"`
 	MapCount          int     `json:"map_count"`
+	CurrentStreak     int     `json:"current_streak"`
+	LongestStreak     int     `json:"longest_streak"`
+	LastActive        string  `json:"last_active"` // YYYY-MM-DD，依查詢時區
+}
+
+// PlayerStreak 用於 /api/streaks 回傳（連續完成天數與最後活躍日）
+type PlayerStreak struct {
+	Name          string `json:"name"`
+	CurrentStreak int    `json:"current_streak"`
+	LongestStreak int    `json:"longest_streak"`
+	LastActive    string `json:"last_active"`   // YYYY-MM-DD，從未完成時為空字串
+	DaysInactive  int    `json:"days_inactive"` // 從未完成時為 -1
 }
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// Presence 為玩家「正在玩」的狀態；ExpiresAt 前未續約（heartbeat）即自動移除
+type Presence struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Player     string    `gorm:"uniqueIndex" json:"player"`
+	MapName    string    `json:"map_name"`
+	Difficulty string    `json:"difficulty"`
+	Partners   string    `json:"partners"` // 同行玩家，格式同 MapRecord.Runner ("A, B")
+	StartedAt  time.Time `json:"started_at"`
+	ExpiresAt  time.Time `gorm:"index" json:"expires_at"`
+}
@@ -4,6 +4,7 @@ import "time"
 
 type Summary struct {
 	ID            uint      `gorm:"primaryKey" json:"id"`
+	Date          string    `gorm:"size:10;uniqueIndex" json:"date"` // YYYY-MM-DD，每天一筆快照
 	CurrentScore  int       `json:"current_score"`
 	TargetScore   int       `json:"target_score"`
 	CompletedMaps int       `json:"completed_maps"`
@@ -1,12 +1,18 @@
 package router
 
 import (
+	_ "embed"
+	"net/http"
+
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 
 	"DDNETONE/service" // 引入 service
 )
 
+//go:embed openapi.json
+var openAPISpec []byte
+
 func InitRouter() *gin.Engine {
 
 	r := gin.Default()
@@ -16,42 +22,79 @@ func InitRouter() *gin.Engine {
 
 		AllowAllOrigins: true,
 
-		AllowMethods: []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders: []string{"Origin", "Content-Type", "X-Admin-Key"},
+		AllowMethods:  []string{"GET", "POST", "PUT", "DELETE"},
+		AllowHeaders:  []string{"Origin", "Content-Type", "X-Admin-Key", "If-Match", "If-None-Match", "If-Modified-Since"},
+		ExposeHeaders: []string{"ETag", "Last-Modified"},
 	}))
 
-	api := r.Group("/api")
-	{
-		api.GET("/sse", service.HandleSSE)
+	// API 文件 (OpenAPI 3)
+	r.GET("/api/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", openAPISpec)
+	})
+
+	// /api/v1 為正式版本；不帶版本的 /api 路徑保留給既有客戶端，內容相同
+	registerRoutes(r.Group("/api/v1"))
+	registerRoutes(r.Group("/api"))
+
+	return r
+}
+
+// registerRoutes 註冊所有 API 路由（/api 與 /api/v1 共用）
+func registerRoutes(g *gin.RouterGroup) {
+	g.GET("/sse", service.HandleSSE)
+	g.GET("/ws", service.HandleWS)
 
-		api.GET("/summary", service.GetSummary)
+	g.GET("/summary", service.GetSummary)
+	g.GET("/summary/history", service.GetSummaryHistory)
+	g.GET("/progress", service.GetProgress)
 
-		api.GET("/leaderboard", service.GetLeaderboard)
+	g.GET("/leaderboard", service.GetLeaderboard)
+	g.GET("/streaks", service.GetStreaks)
 
-		api.GET("/maps", service.GetMaps)
-		api.POST("/records", service.CreateRecord)
-		api.GET("/map-options", service.GetMapOptions)
+	g.GET("/maps", service.GetMaps)
+	g.GET("/maps/search", service.SearchMaps)
+	g.GET("/maps/recommend", service.RecommendMaps)
+	g.POST("/records", service.CreateRecord)
+	g.GET("/map-options", service.GetMapOptions)
 
-		api.GET("/player-options", service.GetPlayerOptions)
+	g.POST("/claims", service.ClaimMap)
+	g.PUT("/claims/:id/renew", service.RenewClaim)
+	g.DELETE("/claims/:id", service.ReleaseClaim)
 
-		api.GET("/growth", service.GetGrowth)
-		api.GET("/milestones", service.GetMilestones)
-		api.GET("/score-milestones", service.GetScoreMilestones)
-		api.GET("/daily-activity", service.GetDailyActivity)
+	g.GET("/player-options", service.GetPlayerOptions)
 
-		admin := api.Group("/admin")
-		admin.Use(service.AdminAuthMiddleware())
-		{
-			admin.GET("/records", service.GetAdminRecords)
-			admin.PUT("/records/:id", service.EditRecord)
-			admin.PUT("/records/:id/undo", service.UndoRecord)
-			admin.POST("/maps", service.CreateAdminMap)
-		}
+	g.GET("/presence", service.GetPresence)
+	g.POST("/presence", service.SetPresence)
+	g.PUT("/presence/:player/heartbeat", service.PresenceHeartbeat)
+	g.DELETE("/presence/:player", service.ClearPresence)
 
-		api.GET("/messages", service.GetMessages)
-		api.POST("/messages", service.CreateMessage)
+	g.GET("/growth", service.GetGrowth)
+	g.GET("/milestones", service.GetMilestones)
+	g.GET("/score-milestones", service.GetScoreMilestones)
+	g.GET("/daily-activity", service.GetDailyActivity)
+	g.GET("/activity-heatmap", service.GetActivityHeatmap)
 
+	admin := g.Group("/admin")
+	admin.Use(service.AdminAuthMiddleware())
+	{
+		admin.GET("/records", service.GetAdminRecords)
+		admin.POST("/records/bulk", service.BulkRecords)
+		admin.PUT("/records/:id", service.EditRecord)
+		admin.PUT("/records/:id/undo", service.UndoRecord)
+		admin.PUT("/records/:id/verify", service.VerifyRecord)
+		admin.GET("/records/:id/transitions", service.GetRecordTransitions)
+		admin.POST("/maps", service.CreateAdminMap)
+		admin.GET("/maps/:id", service.GetAdminMap)
+		admin.PUT("/maps/:id", service.UpdateAdminMap)
+		admin.DELETE("/maps/:id", service.DeleteAdminMap)
+		admin.POST("/maps/:id/merge", service.MergeAdminMap)
+		admin.GET("/sse-stats", service.GetSSEStats)
+		admin.GET("/leaderboard/check", service.CheckLeaderboard)
+		admin.POST("/leaderboard/rebuild", service.RebuildLeaderboard)
+		admin.PUT("/claims/:id", service.AdminOverrideClaim)
+		admin.DELETE("/claims/:id", service.AdminReleaseClaim)
 	}
 
-	return r
+	g.GET("/messages", service.GetMessages)
+	g.POST("/messages", service.CreateMessage)
 }
@@ -0,0 +1,328 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"DDNETONE/model"
+	"DDNETONE/service"
+)
+
+// 這裡的測試確保 openapi.json 與實際的路由及 Go 型別一致：
+// 新增路由或修改回傳欄位時若忘了更新文件，go test 會失敗。
+
+type specSchema struct {
+	Ref        string                 `json:"$ref"`
+	Type       string                 `json:"type"`
+	Format     string                 `json:"format"`
+	Properties map[string]*specSchema `json:"properties"`
+	Items      *specSchema            `json:"items"`
+	Required   []string               `json:"required"`
+	AllOf      []*specSchema          `json:"allOf"`
+}
+
+type spec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]*specSchema `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) spec {
+	t.Helper()
+	var s spec
+	if err := json.Unmarshal(openAPISpec, &s); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	return s
+}
+
+var pathParam = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+// TestSpecCoversRoutes 檢查 registerRoutes 的每個路由都有文件，文件中的每個操作也都有路由
+func TestSpecCoversRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := loadSpec(t)
+
+	r := gin.New()
+	registerRoutes(r.Group("/api/v1"))
+
+	registered := make(map[string]bool)
+	for _, route := range r.Routes() {
+		path := pathParam.ReplaceAllString(strings.TrimPrefix(route.Path, "/api/v1"), "{$1}")
+		method := strings.ToLower(route.Method)
+		registered[method+" "+path] = true
+		if _, ok := s.Paths[path][method]; !ok {
+			t.Errorf("route %s %s is not documented in openapi.json", route.Method, path)
+		}
+	}
+
+	for path, operations := range s.Paths {
+		for method := range operations {
+			if method == "parameters" {
+				continue
+			}
+			if !registered[method+" "+path] {
+				t.Errorf("openapi.json documents %s %s but no such route is registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+var schemaRef = regexp.MustCompile(`"\$ref":\s*"#/components/([a-z]+)/([A-Za-z]+)"`)
+
+// TestSpecRefsResolve 檢查所有 $ref 都指向存在的 component
+func TestSpecRefsResolve(t *testing.T) {
+	var raw struct {
+		Components map[string]map[string]json.RawMessage `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range schemaRef.FindAllStringSubmatch(string(openAPISpec), -1) {
+		if _, ok := raw.Components[m[1]][m[2]]; !ok {
+			t.Errorf("unresolved reference #/components/%s/%s", m[1], m[2])
+		}
+	}
+}
+
+// schemaTypes 為 component schema 對應的 Go 型別；request 為 true 時以 binding:"required" 比對 required
+var schemaTypes = []struct {
+	name    string
+	typ     reflect.Type
+	request bool
+}{
+	{"Error", reflect.TypeFor[service.APIError](), false},
+	{"FieldError", reflect.TypeFor[service.FieldError](), false},
+	{"MapRecord", reflect.TypeFor[model.MapRecord](), false},
+	{"MapRecordPage", reflect.TypeFor[service.Page[model.MapRecord]](), false},
+	{"MapTransition", reflect.TypeFor[model.MapTransition](), false},
+	{"Summary", reflect.TypeFor[model.Summary](), false},
+	{"PlayerStats", reflect.TypeFor[model.PlayerStats](), false},
+	{"PlayerStreak", reflect.TypeFor[model.PlayerStreak](), false},
+	{"StarProgress", reflect.TypeFor[service.StarProgress](), false},
+	{"DifficultyProgress", reflect.TypeFor[service.DifficultyProgress](), false},
+	{"GrowthData", reflect.TypeFor[model.GrowthData](), false},
+	{"GrowthBucket", reflect.TypeFor[model.GrowthBucket](), false},
+	{"Milestone", reflect.TypeFor[service.MilestoneResult](), false},
+	{"DailyActivity", reflect.TypeFor[service.DailyActivity](), false},
+	{"ActivityHeatmap", reflect.TypeFor[service.ActivityHeatmap](), false},
+	{"Presence", reflect.TypeFor[model.Presence](), false},
+	{"SetPresenceResponse", reflect.TypeFor[service.SetPresenceResponse](), false},
+	{"Message", reflect.TypeFor[model.Message](), false},
+	{"MessagePage", reflect.TypeFor[service.Page[model.Message]](), false},
+	{"MergeMapResult", reflect.TypeFor[service.MergeMapResult](), false},
+	{"MapSearchResult", reflect.TypeFor[service.MapSearchResult](), false},
+	{"MapRecommendation", reflect.TypeFor[service.MapRecommendation](), false},
+	{"LeaderboardCheck", reflect.TypeFor[service.LeaderboardCheck](), false},
+	{"SSEStats", reflect.TypeFor[service.SSEStats](), false},
+	{"BulkItemResult", reflect.TypeFor[service.BulkItemResult](), false},
+	{"BulkRecordResult", reflect.TypeFor[service.BulkRecordResult](), false},
+
+	{"SetPresenceRequest", reflect.TypeFor[service.SetPresenceRequest](), true},
+	{"CreateMessageRequest", reflect.TypeFor[service.PostMessageRequest](), true},
+	{"CreateRecordRequest", reflect.TypeFor[service.CreateRecordRequest](), true},
+	{"ClaimMapRequest", reflect.TypeFor[service.ClaimMapRequest](), true},
+	{"AdminClaimRequest", reflect.TypeFor[service.AdminClaimRequest](), true},
+	{"EditRecordRequest", reflect.TypeFor[service.EditRecordRequest](), true},
+	{"CreateAdminMapRequest", reflect.TypeFor[service.CreateAdminMapRequest](), true},
+	{"UpdateAdminMapRequest", reflect.TypeFor[service.UpdateAdminMapRequest](), true},
+	{"MergeMapRequest", reflect.TypeFor[service.MergeMapRequest](), true},
+	{"BulkRecordRequest", reflect.TypeFor[service.BulkRecordRequest](), true},
+}
+
+type jsonField struct {
+	typ       reflect.Type
+	omitempty bool
+	required  bool // binding:"required"
+}
+
+// jsonFields 依 encoding/json 的規則列出 struct 的欄位（含嵌入的 struct）
+func jsonFields(t reflect.Type) map[string]jsonField {
+	fields := make(map[string]jsonField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for k, v := range jsonFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = jsonField{
+			typ:       f.Type,
+			omitempty: slices.Contains(strings.Split(opts, ","), "omitempty"),
+			required:  slices.Contains(strings.Split(f.Tag.Get("binding"), ","), "required"),
+		}
+	}
+	return fields
+}
+
+// schemaTypeOf 回傳 Go 型別在 JSON 中對應的 schema type
+func schemaTypeOf(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeFor[time.Time]() {
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// resolve 展開 #/components/schemas/ 的參照，並將 allOf 合併為單一 schema
+func resolve(s spec, schema *specSchema) *specSchema {
+	for schema != nil && schema.Ref != "" {
+		schema = s.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")]
+	}
+	if schema == nil || len(schema.AllOf) == 0 {
+		return schema
+	}
+	merged := &specSchema{Type: schema.Type, Properties: make(map[string]*specSchema), Required: schema.Required}
+	for name, prop := range schema.Properties {
+		merged.Properties[name] = prop
+	}
+	for _, part := range schema.AllOf {
+		part = resolve(s, part)
+		if merged.Type == "" {
+			merged.Type, merged.Format, merged.Items = part.Type, part.Format, part.Items
+		}
+		for name, prop := range part.Properties {
+			merged.Properties[name] = prop
+		}
+		merged.Required = append(merged.Required, part.Required...)
+	}
+	return merged
+}
+
+// TestSchemasMatchGoTypes 比對 component schema 的欄位名稱、型別與 required 是否與 Go struct 一致
+func TestSchemasMatchGoTypes(t *testing.T) {
+	s := loadSpec(t)
+
+	for _, st := range schemaTypes {
+		t.Run(st.name, func(t *testing.T) {
+			schema := resolve(s, s.Components.Schemas[st.name])
+			if schema == nil {
+				t.Fatalf("schema %s is missing", st.name)
+			}
+			fields := jsonFields(st.typ)
+
+			for name, field := range fields {
+				prop := resolve(s, schema.Properties[name])
+				if prop == nil {
+					t.Errorf("%s.%s is not documented", st.typ, name)
+					continue
+				}
+				if want := schemaTypeOf(field.typ); prop.Type != "" && prop.Type != want {
+					t.Errorf("%s: documented as %s, Go type %s encodes as %s", name, prop.Type, field.typ, want)
+				}
+				if want := schemaTypeOf(field.typ); prop.Type == "" && want != "object" && prop.Properties == nil {
+					t.Errorf("%s: documented without a type, Go type %s encodes as %s", name, field.typ, want)
+				}
+
+				required := slices.Contains(schema.Required, name)
+				switch {
+				case st.request && field.required && !required:
+					t.Errorf("%s is required by the binding but not in the schema", name)
+				case !st.request && !field.omitempty && !required:
+					t.Errorf("%s is always present in responses but not marked required", name)
+				case !st.request && field.omitempty && required:
+					t.Errorf("%s is omitted when empty but marked required", name)
+				}
+			}
+
+			for name := range schema.Properties {
+				if _, ok := fields[name]; !ok {
+					t.Errorf("%s documents %q but %s has no such field", st.name, name, st.typ)
+				}
+			}
+			for _, name := range schema.Required {
+				if _, ok := fields[name]; !ok {
+					t.Errorf("%s requires %q but %s has no such field", st.name, name, st.typ)
+				}
+			}
+		})
+	}
+}
+
+// TestErrorResponseMatchesSchema 以實際的 handler 回應檢查錯誤格式（不需要資料庫的路徑）
+func TestErrorResponseMatchesSchema(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := loadSpec(t)
+	schema := resolve(s, s.Components.Schemas["Error"])
+
+	r := gin.New()
+	registerRoutes(r.Group("/api/v1"))
+
+	cases := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodGet, "/api/v1/admin/records", "", http.StatusUnauthorized},
+		{http.MethodPost, "/api/v1/records", `{"map_name": 1}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/records", `{"map_name": "x", "difficulty": "nope", "status": 9}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/v1/claims/abc/renew", "", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		w := httptestRequest(r, tc.method, tc.path, tc.body)
+		if w.Code != tc.status {
+			t.Errorf("%s %s: status %d, want %d (%s)", tc.method, tc.path, w.Code, tc.status, w.Body)
+			continue
+		}
+
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s %s: response is not a JSON object: %v", tc.method, tc.path, err)
+			continue
+		}
+		for _, name := range schema.Required {
+			if _, ok := body[name]; !ok {
+				t.Errorf("%s %s: response is missing %q", tc.method, tc.path, name)
+			}
+		}
+		for name := range body {
+			if _, ok := schema.Properties[name]; !ok {
+				t.Errorf("%s %s: response has undocumented field %q", tc.method, tc.path, name)
+			}
+		}
+	}
+}
+
+func httptestRequest(r http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
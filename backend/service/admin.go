@@ -3,10 +3,12 @@ package service
 import (
 	"net/http"
 	"os"
+	"time"
 
 	"DDNETONE/db"
 	"DDNETONE/model"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // AdminAuthMiddleware 驗證 X-Admin-Key header
@@ -14,129 +16,138 @@ func AdminAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		key := c.GetHeader("X-Admin-Key")
 		if key == "" || key != os.Getenv("ADMIN_KEY") {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			respondError(c, unauthorized("missing or invalid X-Admin-Key"))
 			return
 		}
 		c.Next()
 	}
 }
 
-// GetAdminRecords 取得所有已完成記錄供管理
+// GetAdminRecords 取得記錄供管理；未指定 status 時只列出已完成的記錄
+// 預設依 finish_time 由新到舊；paginate=false 回傳完整陣列
 func GetAdminRecords(c *gin.Context) {
-	var records []model.MapRecord
-	db.GetDB().Where("status = 2").Order("finish_time desc").Find(&records)
-	c.JSON(http.StatusOK, records)
+	page, err := parsePage(c, recordSorts, "finish_time", true)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+	query := db.GetDB().Model(&model.MapRecord{})
+	if c.Query("status") == "" {
+		query = query.Where("status IN ?", model.CompletedStatuses)
+	}
+	query, err = applyRecordFilters(c, query)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+
+	result, err := paginate(query, page, recordSorts, recordID)
+	if err != nil {
+		respondError(c, internalError("failed to load records", err))
+		return
+	}
+	respondPage(c, page, result)
 }
 
 type EditRecordRequest struct {
-	Note   *string `json:"note"`
-	Runner *string `json:"runner"`
+	Note   *string `json:"note" binding:"omitempty,max=500"`
+	Runner *string `json:"runner" binding:"omitempty,max=128,runners"`
 }
 
 // EditRecord 修改 note 或 runner
 func EditRecord(c *gin.Context) {
-	id := c.Param("id")
+	id, err := pathID(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
 	var record model.MapRecord
 	if err := db.GetDB().First(&record, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "record not found"})
+		respondError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, record); err != nil {
+		respondError(c, err)
 		return
 	}
 
 	var req EditRecordRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := bindJSON(c, &req); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	database := db.GetDB()
-
 	if req.Note != nil {
 		record.Note = *req.Note
 	}
 
 	if req.Runner != nil {
-		record.Runner = *req.Runner
+		if err := setRecordRunner(&record, *req.Runner); err != nil {
+			respondError(c, err)
+			return
+		}
 	}
 
-	if err := database.Save(&record).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update record"})
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		return saveRecord(tx, &record)
+	})
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	BroadcastUpdate()
-	c.JSON(http.StatusOK, record)
+	BroadcastUpdate(record)
+	respondRecord(c, http.StatusOK, record)
 }
 
-// UndoRecord 將已完成的記錄(status=2)還原為未完成(status=0)
+// UndoRecord 將已完成、已驗證或已加載的記錄還原為未完成(status=0)
 func UndoRecord(c *gin.Context) {
-	id := c.Param("id")
+	id, err := pathID(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
 	var record model.MapRecord
 	if err := db.GetDB().First(&record, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "record not found"})
+		respondError(c, err)
 		return
 	}
-
-	if record.Status != 2 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "record is not completed"})
+	if err := checkIfMatch(c, record); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	database := db.GetDB()
-
-	// 刪除對應的 growth_data 快照
-	database.Where("map_name = ? AND runner = ?", record.MapName, record.Runner).
-		Delete(&model.GrowthData{})
-
-	// 重置記錄
-	record.Status = 0
-	record.Runner = ""
-	record.Score = 0
-	record.FinishTime = nil
-	record.HasDummy = false
-
-	if err := database.Save(&record).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to undo record"})
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := revertRecord(tx, &record, time.Now()); err != nil {
+			return err
+		}
+		_, err := refreshSummary(tx)
+		return err
+	})
+	if err != nil {
+		respondError(c, err)
 		return
 	}
 
-	UpdateGlobalSummary()
-	BroadcastUpdate()
-	c.JSON(http.StatusOK, record)
-}
-
-type CreateAdminMapRequest struct {
-	MapName    string `json:"map_name" binding:"required"`
-	Difficulty string `json:"difficulty" binding:"required"`
-	Points     int    `json:"points"`
-	Stars      int    `json:"stars"`
+	BroadcastUpdate(record)
+	respondRecord(c, http.StatusOK, record)
 }
 
-func CreateAdminMap(c *gin.Context) {
-	var req CreateAdminMapRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	database := db.GetDB()
-	var existing model.MapRecord
-	if err := database.Where("map_name = ? AND difficulty = ?", req.MapName, req.Difficulty).First(&existing).Error; err == nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "map already exists"})
-		return
-	}
-
-	record := model.MapRecord{
-		MapName:    req.MapName,
-		Difficulty: req.Difficulty,
-		Points:     req.Points,
-		Stars:      req.Stars,
-		Status:     0,
+// setRecordRunner 修改執行者；非未完成狀態必須保留執行者
+func setRecordRunner(record *model.MapRecord, runner string) error {
+	if runner == "" && record.Status != model.StatusUnplayed {
+		return badRequest("runner cannot be empty unless the map is unplayed")
 	}
+	record.Runner = runner
+	return nil
+}
 
-	if err := database.Create(&record).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create map"})
-		return
+// revertRecord 刪除記錄對應的 growth_data 快照並還原為未完成（不更新總覽）
+func revertRecord(tx *gorm.DB, record *model.MapRecord, now time.Time) error {
+	if err := tx.Where("map_name = ? AND runner = ?", record.MapName, record.Runner).
+		Delete(&model.GrowthData{}).Error; err != nil {
+		return err
 	}
-
-	c.JSON(http.StatusCreated, record)
+	_, err := transitionRecord(tx, record, model.ActionRevert, "", now)
+	return err
 }
@@ -0,0 +1,369 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"DDNETONE/db"
+	"DDNETONE/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Admin map management — 地圖與記錄是同一張表（map_records，一張地圖一個難度一筆），
+// 因此這裡的 CRUD 操作的是地圖本身的欄位（名稱、難度、points、stars、mapper、retired），
+// 完成狀態仍只能透過 lifecycle 變更。
+
+var (
+	errMergeBothPlayed = errors.New("both maps have progress; undo one of them before merging")
+	errMapExists       = errors.New("map already exists")
+)
+
+type CreateAdminMapRequest struct {
+	MapName    string `json:"map_name" binding:"required,max=128"`
+	Difficulty string `json:"difficulty" binding:"required,difficulty"`
+	Points     int    `json:"points" binding:"min=0"`
+	Stars      int    `json:"stars" binding:"min=0,max=5"`
+	Mapper     string `json:"mapper" binding:"max=128"`
+}
+
+func CreateAdminMap(c *gin.Context) {
+	var req CreateAdminMapRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	record := model.MapRecord{
+		MapName:    req.MapName,
+		Difficulty: req.Difficulty,
+		Points:     req.Points,
+		Stars:      req.Stars,
+		Mapper:     req.Mapper,
+		Status:     model.StatusUnplayed,
+	}
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		// 仍有待合併的重複地圖時唯一鍵只是部分索引（見 db.migrateMapRecordDuplicates），
+		// 因此先明確檢查是否已存在
+		var existing int64
+		if err := tx.Model(&model.MapRecord{}).
+			Where("map_name = ? AND difficulty = ?", record.MapName, record.Difficulty).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return errMapExists
+		}
+		if err := saveRecord(tx, &record); err != nil {
+			return err
+		}
+		_, err := refreshSummary(tx)
+		return err
+	})
+	if errors.Is(err, errMapExists) || errors.Is(err, gorm.ErrDuplicatedKey) {
+		respondError(c, conflict(errMapExists.Error()))
+		return
+	}
+	if err != nil {
+		respondError(c, internalError("failed to create map", err))
+		return
+	}
+
+	BroadcastUpdate(record)
+	respondRecord(c, http.StatusCreated, record)
+}
+
+// GetAdminMap 回傳單一地圖（含 ETag，供之後的 If-Match 使用）
+func GetAdminMap(c *gin.Context) {
+	id, err := pathID(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var record model.MapRecord
+	if err := db.GetDB().First(&record, id).Error; err != nil {
+		respondError(c, err)
+		return
+	}
+	respondRecord(c, http.StatusOK, record)
+}
+
+// UpdateAdminMapRequest 只更新有帶的欄位
+type UpdateAdminMapRequest struct {
+	MapName    *string `json:"map_name" binding:"omitempty,min=1,max=128"`
+	Difficulty *string `json:"difficulty" binding:"omitempty,difficulty"`
+	Points     *int    `json:"points" binding:"omitempty,min=0"`
+	Stars      *int    `json:"stars" binding:"omitempty,min=0,max=5"`
+	Mapper     *string `json:"mapper" binding:"omitempty,max=128"`
+	Retired    *bool   `json:"retired"`
+}
+
+// updateMapTx 在 tx 內套用地圖欄位的修改：
+//   - 改名或改難度時一併更新成長快照與 presence 的地圖名稱
+//   - 已完成且 score 等於原本 points（自動計分）的記錄，score 跟著新的 points
+//   - 退役時釋放預約
+func updateMapTx(tx *gorm.DB, record *model.MapRecord, req UpdateAdminMapRequest, now time.Time) error {
+	oldName, oldDifficulty := record.MapName, record.Difficulty
+
+	if req.MapName != nil {
+		record.MapName = *req.MapName
+	}
+	if req.Difficulty != nil {
+		record.Difficulty = *req.Difficulty
+	}
+	if req.Points != nil {
+		if model.IsCompleted(record.Status) && record.Score == record.Points {
+			record.Score = *req.Points
+		}
+		record.Points = *req.Points
+	}
+	if req.Stars != nil {
+		record.Stars = *req.Stars
+	}
+	if req.Mapper != nil {
+		record.Mapper = *req.Mapper
+	}
+	// 欄位修改與釋放預約一起寫入，只更新一次（版本號只遞增一次）
+	var release *model.MapTransition
+	if req.Retired != nil {
+		record.Retired = *req.Retired
+		if record.Retired && record.Status == model.StatusWIP {
+			transition, err := record.Transition(model.ActionRelease, "", now)
+			if err != nil {
+				return err
+			}
+			release = &transition
+		}
+	}
+
+	if err := saveRecord(tx, record); err != nil {
+		return err
+	}
+	if release != nil {
+		if err := recordTransition(tx, *record, *release); err != nil {
+			return err
+		}
+	}
+
+	if record.MapName != oldName || record.Difficulty != oldDifficulty {
+		if record.MapName != oldName && record.Runner != "" {
+			if err := tx.Model(&model.GrowthData{}).
+				Where("map_name = ? AND runner = ?", oldName, record.Runner).
+				Update("map_name", record.MapName).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(&model.Presence{}).
+			Where("map_name = ? AND difficulty = ?", oldName, oldDifficulty).
+			Updates(map[string]interface{}{"map_name": record.MapName, "difficulty": record.Difficulty}).Error; err != nil {
+			return err
+		}
+	}
+
+	_, err := refreshSummary(tx)
+	return err
+}
+
+// UpdateAdminMap 改名、移到其他難度、修正 points / stars / mapper，或設定 retired
+func UpdateAdminMap(c *gin.Context) {
+	id, err := pathID(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var record model.MapRecord
+	if err := db.GetDB().First(&record, id).Error; err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, record); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	var req UpdateAdminMapRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	before := record
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		return updateMapTx(tx, &record, req, time.Now())
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	BroadcastUpdate(record)
+	if record.MapName != before.MapName || record.Difficulty != before.Difficulty {
+		BroadcastPresence()
+	}
+	respondRecord(c, http.StatusOK, record)
+}
+
+// DeleteAdminMap 刪除地圖及其狀態變更歷史與成長快照
+func DeleteAdminMap(c *gin.Context) {
+	id, err := pathID(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var record model.MapRecord
+	if err := db.GetDB().First(&record, id).Error; err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, record); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	err = db.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := deleteRecord(tx, record); err != nil {
+			return err
+		}
+		_, err := refreshSummary(tx)
+		return err
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	BroadcastRecordChanges(nil, []model.MapRecord{record})
+	c.Status(http.StatusNoContent)
+}
+
+type MergeMapRequest struct {
+	DuplicateID uint `json:"duplicate_id" binding:"required"`
+}
+
+// MergeMapResult 為合併後保留的地圖與被刪除的重複地圖
+type MergeMapResult struct {
+	Map              model.MapRecord `json:"map"`
+	Removed          model.MapRecord `json:"removed"`
+	MovedTransitions int64           `json:"moved_transitions"`
+	MovedGrowth      int64           `json:"moved_growth"`
+}
+
+// mergeMapTx 將 duplicate 合併進 record：duplicate 的完成狀態（若 record 尚未開始）、
+// 狀態變更歷史與成長快照移到 record 後刪除 duplicate
+func mergeMapTx(tx *gorm.DB, record, duplicate *model.MapRecord, now time.Time) (MergeMapResult, error) {
+	result := MergeMapResult{}
+
+	if duplicate.Status != model.StatusUnplayed {
+		if record.Status != model.StatusUnplayed {
+			return result, errMergeBothPlayed
+		}
+		from := record.Status
+		record.Status = duplicate.Status
+		record.Runner = duplicate.Runner
+		record.Score = duplicate.Score
+		record.FinishTime = duplicate.FinishTime
+		record.HasDummy = duplicate.HasDummy
+		record.ClaimedAt = duplicate.ClaimedAt
+		record.ClaimExpiresAt = duplicate.ClaimExpiresAt
+		if err := tx.Create(&model.MapTransition{
+			MapRecordID: record.ID,
+			Action:      model.ActionMerge,
+			FromStatus:  from,
+			ToStatus:    record.Status,
+			Runner:      record.Runner,
+			CreatedAt:   now,
+		}).Error; err != nil {
+			return result, err
+		}
+	}
+	if record.Note == "" {
+		record.Note = duplicate.Note
+	}
+	if record.Mapper == "" {
+		record.Mapper = duplicate.Mapper
+	}
+
+	moved := tx.Model(&model.MapTransition{}).Where("map_record_id = ?", duplicate.ID).Update("map_record_id", record.ID)
+	if moved.Error != nil {
+		return result, moved.Error
+	}
+	result.MovedTransitions = moved.RowsAffected
+
+	if duplicate.Runner != "" && duplicate.MapName != record.MapName {
+		moved := tx.Model(&model.GrowthData{}).
+			Where("map_name = ? AND runner = ?", duplicate.MapName, duplicate.Runner).
+			Update("map_name", record.MapName)
+		if moved.Error != nil {
+			return result, moved.Error
+		}
+		result.MovedGrowth = moved.RowsAffected
+	}
+
+	deleted := tx.Where("version = ?", duplicate.Version).Delete(&model.MapRecord{}, duplicate.ID)
+	if deleted.Error != nil {
+		return result, deleted.Error
+	}
+	if deleted.RowsAffected == 0 {
+		return result, errVersionConflict
+	}
+	if err := saveRecord(tx, record); err != nil {
+		return result, err
+	}
+	if _, err := refreshSummary(tx); err != nil {
+		return result, err
+	}
+
+	result.Map, result.Removed = *record, *duplicate
+	return result, nil
+}
+
+// MergeAdminMap 將重複的地圖 (duplicate_id) 合併進 :id 後刪除重複的那筆
+// If-Match 比對的是保留的地圖
+func MergeAdminMap(c *gin.Context) {
+	var req MergeMapRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	id, err := pathID(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	database := db.GetDB()
+	var record, duplicate model.MapRecord
+	if err := database.First(&record, id).Error; err != nil {
+		respondError(c, err)
+		return
+	}
+	if record.ID == req.DuplicateID {
+		respondError(c, validationFailed(FieldError{Field: "duplicate_id", Message: "must differ from the map being kept"}))
+		return
+	}
+	if err := checkIfMatch(c, record); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := database.First(&duplicate, req.DuplicateID).Error; err != nil {
+		respondError(c, err)
+		return
+	}
+
+	var result MergeMapResult
+	err = database.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = mergeMapTx(tx, &record, &duplicate, time.Now())
+		return err
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	BroadcastRecordChanges([]model.MapRecord{record}, []model.MapRecord{duplicate})
+	c.Header("ETag", recordETag(record))
+	c.JSON(http.StatusOK, result)
+}
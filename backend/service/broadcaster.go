@@ -0,0 +1,200 @@
+package service
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"DDNETONE/model"
+)
+
+// Async broadcaster — handlers only enqueue; a single worker debounces bursts
+// and runs the delta computation (buildDeltas) at most once at a time.
+
+const (
+	// broadcastDebounce 為最後一次通知後等待的時間，期間的通知會合併成一次廣播
+	broadcastDebounce = 250 * time.Millisecond
+	// broadcastMaxDelay 為第一次通知到廣播的最長等待時間，避免持續寫入時永遠不廣播
+	broadcastMaxDelay = time.Second
+)
+
+// pendingChange describes what a mutation touched.
+type pendingChange struct {
+	records    []model.MapRecord
+	deleted    []model.MapRecord // 已刪除的記錄（只用到 ID、Difficulty、Runner）
+	messages   []model.Message
+	aggregates bool // 需要重新計算 summary / leaderboard / progress / growth
+	presence   bool
+	// local 表示由本實例寫入，廣播時透過 NOTIFY 告知其他實例（見 notify.go）；
+	// 只由其他實例觸發的批次不再轉發，避免互相通知形成迴圈
+	local bool
+}
+
+type broadcaster struct {
+	mu        sync.Mutex
+	pending   bool
+	batch     pendingChange
+	recordIdx map[uint]int // MapRecord.ID -> index in batch.records（同一筆以版本最新者為準）
+
+	// 本機寫入的 ID，隨 NOTIFY 送出
+	localRecordIDs  []uint
+	localMessageIDs []uint
+	localDeleted    []deletedRecord
+
+	wake      chan struct{}
+	startOnce sync.Once
+}
+
+var sseBroadcaster = &broadcaster{
+	recordIdx: make(map[uint]int),
+	wake:      make(chan struct{}, 1),
+}
+
+// BroadcastUpdate schedules a delta broadcast and returns immediately. changed
+// lists the MapRecords touched by the mutation; they are sent in record.updated events.
+func BroadcastUpdate(changed ...model.MapRecord) {
+	sseBroadcaster.enqueue(pendingChange{records: changed, aggregates: true, local: true})
+}
+
+// BroadcastRecordChanges is BroadcastUpdate plus deleted records, which are sent
+// in record.deleted events (bulk operations broadcast both in one batch).
+func BroadcastRecordChanges(changed, deleted []model.MapRecord) {
+	sseBroadcaster.enqueue(pendingChange{records: changed, deleted: deleted, aggregates: true, local: true})
+}
+
+// BroadcastMessage schedules a message.created event for clients subscribed to messages.
+func BroadcastMessage(msg model.Message) {
+	sseBroadcaster.enqueue(pendingChange{messages: []model.Message{msg}, local: true})
+}
+
+// BroadcastPresence schedules a presence.changed event with the current presence list.
+func BroadcastPresence() {
+	sseBroadcaster.enqueue(pendingChange{presence: true, local: true})
+}
+
+// enqueue merges change into the next broadcast.
+func (b *broadcaster) enqueue(change pendingChange) {
+	b.startOnce.Do(func() { go b.run() })
+
+	// 排行榜索引在排入廣播時就更新，API 讀取不必等 debounce；
+	// 比索引舊的記錄（較晚排入但較早 commit）不再廣播
+	if len(change.records) > 0 {
+		change.records = leaderboardCache.apply(change.records)
+	}
+	for _, r := range change.deleted {
+		leaderboardCache.forget(r.ID)
+	}
+
+	b.mu.Lock()
+	b.pending = true
+	for _, r := range change.records {
+		if i, ok := b.recordIdx[r.ID]; ok {
+			if r.Version > b.batch.records[i].Version {
+				b.batch.records[i] = r
+			}
+			continue
+		}
+		b.recordIdx[r.ID] = len(b.batch.records)
+		b.batch.records = append(b.batch.records, r)
+	}
+	for _, r := range change.deleted {
+		// 同一批次內先更新後刪除的記錄只送出刪除
+		if i, ok := b.recordIdx[r.ID]; ok {
+			b.batch.records = slices.Delete(b.batch.records, i, i+1)
+			delete(b.recordIdx, r.ID)
+			for id, j := range b.recordIdx {
+				if j > i {
+					b.recordIdx[id] = j - 1
+				}
+			}
+		}
+		b.batch.deleted = append(b.batch.deleted, r)
+	}
+	b.batch.messages = append(b.batch.messages, change.messages...)
+	b.batch.aggregates = b.batch.aggregates || change.aggregates
+	b.batch.presence = b.batch.presence || change.presence
+	if change.local {
+		b.batch.local = true
+		for _, r := range change.records {
+			b.localRecordIDs = append(b.localRecordIDs, r.ID)
+		}
+		for _, m := range change.messages {
+			b.localMessageIDs = append(b.localMessageIDs, m.ID)
+		}
+		for _, r := range change.deleted {
+			b.localDeleted = append(b.localDeleted, deletedRecord{ID: r.ID, Difficulty: r.Difficulty, Runner: r.Runner})
+		}
+	}
+	b.mu.Unlock()
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// take returns and clears everything queued so far.
+func (b *broadcaster) take() (batch pendingChange, notification changeNotification, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	batch, ok = b.batch, b.pending
+	notification = changeNotification{
+		Origin:     instanceID,
+		RecordIDs:  b.localRecordIDs,
+		MessageIDs: b.localMessageIDs,
+		Deleted:    b.localDeleted,
+		Aggregates: batch.aggregates,
+		Presence:   batch.presence,
+	}
+
+	b.batch, b.pending = pendingChange{}, false
+	b.localRecordIDs, b.localMessageIDs, b.localDeleted = nil, nil, nil
+	b.recordIdx = make(map[uint]int)
+	return batch, notification, ok
+}
+
+func (b *broadcaster) run() {
+	for range b.wake {
+		// 在 debounce 視窗內持續收到通知就延後，但不超過 broadcastMaxDelay
+		deadline := time.Now().Add(broadcastMaxDelay)
+		timer := time.NewTimer(broadcastDebounce)
+		for waiting := true; waiting; {
+			select {
+			case <-b.wake:
+				timer.Reset(min(broadcastDebounce, time.Until(deadline)))
+			case <-timer.C:
+				waiting = false
+			}
+		}
+
+		batch, notification, ok := b.take()
+		if !ok {
+			continue
+		}
+		if batch.local {
+			notifyPeers(notification)
+		}
+		publish(func() ([]sseEvent, error) {
+			events, err := buildMessageEvents(batch.messages)
+			if err != nil {
+				return nil, err
+			}
+			if batch.presence {
+				e, err := buildPresenceEvent()
+				if err != nil {
+					return nil, err
+				}
+				events = append(events, e)
+			}
+			if batch.aggregates || len(batch.records) > 0 || len(batch.deleted) > 0 {
+				deltas, err := buildDeltas(batch.records, batch.deleted)
+				if err != nil {
+					return nil, err
+				}
+				events = append(events, deltas...)
+			}
+			return events, nil
+		})
+	}
+}
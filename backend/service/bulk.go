@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"DDNETONE/db"
+	"DDNETONE/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Bulk record operations — 所有項目在同一個交易內執行，每個項目各自使用
+// savepoint，因此一個項目失敗不會影響其他項目的檢查結果。任何項目失敗或
+// dry_run=true 時整個交易 rollback（回傳的 items / summary 即為預覽）；
+// 全部成功才 commit，總覽只重新計算一次、廣播也只送出一次。
+// 一次最多 500 筆（ids 的 binding tag）。
+
+// Bulk actions
+const (
+	BulkUndo            = "undo"             // 已完成 / 已驗證 / 已加載 → 未完成
+	BulkSetRunner       = "set_runner"       // 修改執行者（同 EditRecord）
+	BulkSetDifficulty   = "set_difficulty"   // 移到其他難度
+	BulkRecomputePoints = "recompute_points" // 已完成記錄的 score 重設為地圖目前的 points
+	BulkDelete          = "delete"           // 刪除記錄、狀態變更歷史與成長快照
+)
+
+// Bulk item statuses
+const (
+	BulkItemOK        = "ok"
+	BulkItemUnchanged = "unchanged"
+	BulkItemFailed    = "failed"
+)
+
+// CodeBulkFailed 表示至少一個項目失敗，整批未套用
+const CodeBulkFailed = "bulk_failed"
+
+// errBulkRollback 用來在 dry run 或有項目失敗時 rollback 交易
+var errBulkRollback = errors.New("bulk operation rolled back")
+
+type BulkRecordRequest struct {
+	Action     string  `json:"action" binding:"required,oneof=undo set_runner set_difficulty recompute_points delete"`
+	IDs        []uint  `json:"ids" binding:"required,min=1,max=500,unique"`
+	Runner     *string `json:"runner" binding:"required_if=Action set_runner,omitempty,max=128,runners"`
+	Difficulty string  `json:"difficulty" binding:"required_if=Action set_difficulty,omitempty,difficulty"`
+	DryRun     bool    `json:"dry_run"`
+}
+
+// BulkItemResult 為單一記錄的結果；Before / After 為套用前後的內容（刪除時沒有 After）
+type BulkItemResult struct {
+	ID     uint             `json:"id"`
+	Status string           `json:"status"`
+	Code   string           `json:"code,omitempty"`
+	Error  string           `json:"error,omitempty"`
+	Before *model.MapRecord `json:"before,omitempty"`
+	After  *model.MapRecord `json:"after,omitempty"`
+}
+
+// BulkRecordResult 為整批的結果；失敗時 code / error 與錯誤格式相同
+type BulkRecordResult struct {
+	Code      string           `json:"code,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Action    string           `json:"action"`
+	DryRun    bool             `json:"dry_run"`
+	Applied   bool             `json:"applied"`
+	Succeeded int              `json:"succeeded"`
+	Unchanged int              `json:"unchanged"`
+	Failed    int              `json:"failed"`
+	Items     []BulkItemResult `json:"items"`
+	Summary   *model.Summary   `json:"summary,omitempty"` // 套用後（或預覽）的總覽
+}
+
+// applyBulkAction 在 tx 內對單筆記錄執行動作；回傳 false 表示記錄不需變更
+func applyBulkAction(tx *gorm.DB, record *model.MapRecord, req BulkRecordRequest, now time.Time) (bool, error) {
+	switch req.Action {
+	case BulkUndo:
+		return true, revertRecord(tx, record, now)
+
+	case BulkSetRunner:
+		if record.Runner == *req.Runner {
+			return false, nil
+		}
+		if err := setRecordRunner(record, *req.Runner); err != nil {
+			return false, err
+		}
+		return true, saveRecord(tx, record)
+
+	case BulkSetDifficulty:
+		if record.Difficulty == req.Difficulty {
+			return false, nil
+		}
+		record.Difficulty = req.Difficulty
+		return true, saveRecord(tx, record)
+
+	case BulkRecomputePoints:
+		if !model.IsCompleted(record.Status) || record.Score == record.Points {
+			return false, nil
+		}
+		record.Score = record.Points
+		return true, saveRecord(tx, record)
+
+	case BulkDelete:
+		return true, deleteRecord(tx, *record)
+	}
+	return false, fmt.Errorf("unknown bulk action %q", req.Action)
+}
+
+// deleteRecord 刪除記錄及其狀態變更歷史；已完成的記錄一併刪除對應的成長快照
+func deleteRecord(tx *gorm.DB, record model.MapRecord) error {
+	if record.Status != model.StatusUnplayed && record.Runner != "" {
+		if err := tx.Where("map_name = ? AND runner = ?", record.MapName, record.Runner).
+			Delete(&model.GrowthData{}).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where("map_record_id = ?", record.ID).Delete(&model.MapTransition{}).Error; err != nil {
+		return err
+	}
+	result := tx.Where("version = ?", record.Version).Delete(&model.MapRecord{}, record.ID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errVersionConflict
+	}
+	return nil
+}
+
+// BulkRecords 在同一個交易內對多筆記錄執行 undo / set_runner / set_difficulty /
+// recompute_points / delete；dry_run=true 時只回傳預覽
+func BulkRecords(c *gin.Context) {
+	var req BulkRecordRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	result := BulkRecordResult{Action: req.Action, DryRun: req.DryRun, Items: make([]BulkItemResult, 0, len(req.IDs))}
+	var updated, deleted []model.MapRecord
+	now := time.Now()
+
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		for _, id := range req.IDs {
+			item := BulkItemResult{ID: id}
+			var changed bool
+			var record model.MapRecord
+
+			// 巢狀交易 = savepoint：失敗時只 rollback 這個項目
+			err := tx.Transaction(func(itx *gorm.DB) error {
+				if err := itx.First(&record, id).Error; err != nil {
+					return err
+				}
+				before := record
+				item.Before = &before
+
+				var err error
+				changed, err = applyBulkAction(itx, &record, req, now)
+				return err
+			})
+
+			switch {
+			case err != nil:
+				apiErr := toAPIError(err)
+				item.Status, item.Code, item.Error = BulkItemFailed, apiErr.Code, apiErr.Message
+				result.Failed++
+			case !changed:
+				item.Status = BulkItemUnchanged
+				result.Unchanged++
+			case req.Action == BulkDelete:
+				item.Status = BulkItemOK
+				deleted = append(deleted, record)
+				result.Succeeded++
+			default:
+				item.Status = BulkItemOK
+				after := record
+				item.After = &after
+				updated = append(updated, record)
+				result.Succeeded++
+			}
+			result.Items = append(result.Items, item)
+		}
+
+		if result.Failed > 0 {
+			return errBulkRollback
+		}
+		summary, err := refreshSummary(tx)
+		if err != nil {
+			return err
+		}
+		result.Summary = &summary
+		if req.DryRun {
+			return errBulkRollback
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBulkRollback) {
+		respondError(c, internalError("failed to apply bulk operation", err))
+		return
+	}
+
+	if result.Failed > 0 {
+		result.Code = CodeBulkFailed
+		result.Error = fmt.Sprintf("%d of %d items failed; nothing was applied", result.Failed, len(req.IDs))
+		status := http.StatusConflict
+		if req.DryRun {
+			status = http.StatusOK
+		}
+		c.JSON(status, result)
+		return
+	}
+	if req.DryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	result.Applied = true
+	if len(updated) > 0 || len(deleted) > 0 {
+		BroadcastRecordChanges(updated, deleted)
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,329 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"DDNETONE/db"
+	"DDNETONE/model"
+	"DDNETONE/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Map claims — 將未完成的地圖預約為進行中 (status 0 → 1)，Runner 記錄預約者。
+// 預約在 CLAIM_TTL 後到期，期間可續約；到期由 StartClaimSweeper 自動釋放。
+
+const (
+	defaultClaimTTL    = 6 * time.Hour
+	claimSweepInterval = time.Minute
+
+	// claimSweepLockKey 為 sweepExpiredClaims 使用的 advisory lock key
+	claimSweepLockKey = 0x646e6f32 // "dno2"
+)
+
+var (
+	errMapCompleted = errors.New("map already completed")
+	errMapClaimed   = errors.New("map is claimed by another group")
+	errNotClaimed   = errors.New("map is not claimed")
+)
+
+var (
+	claimTTLValue time.Duration
+	claimTTLOnce  sync.Once
+)
+
+// claimTTL 回傳預約有效時間，可由 CLAIM_TTL 設定（Go duration，例如 "6h"、"90m"）
+func claimTTL() time.Duration {
+	claimTTLOnce.Do(func() {
+		claimTTLValue = defaultClaimTTL
+		if raw := os.Getenv("CLAIM_TTL"); raw != "" {
+			ttl, err := time.ParseDuration(raw)
+			if err != nil || ttl <= 0 {
+				log.Printf("Ignoring invalid CLAIM_TTL=%q", raw)
+				return
+			}
+			claimTTLValue = ttl
+		}
+	})
+	return claimTTLValue
+}
+
+// ClaimMapRequest 將未完成的地圖標記為進行中 (WIP)
+type ClaimMapRequest struct {
+	MapName    string `json:"map_name" binding:"required,max=128"`
+	Difficulty string `json:"difficulty" binding:"required,difficulty"`
+	Runner     string `json:"runner" binding:"required,max=128,runners"`
+}
+
+// AdminClaimRequest 管理員強制指定預約者，TTLMinutes 為 0 時使用預設 CLAIM_TTL
+type AdminClaimRequest struct {
+	Runner     string `json:"runner" binding:"required,max=128,runners"`
+	TTLMinutes int    `json:"ttl_minutes" binding:"min=0"`
+}
+
+// applyClaim 將記錄設為 WIP 並設定到期時間；ttl 為 0 時使用 claimTTL()
+func applyClaim(record *model.MapRecord, runner string, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = claimTTL()
+	}
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		expires := now.Add(ttl)
+		record.ClaimExpiresAt = &expires
+		return transitionTx(tx, record, model.ActionClaim, runner, now)
+	})
+}
+
+// claimActive 判斷預約是否仍有效（舊資料沒有到期時間時視為有效）
+func claimActive(record model.MapRecord, now time.Time) bool {
+	return record.Status == model.StatusWIP && (record.ClaimExpiresAt == nil || record.ClaimExpiresAt.After(now))
+}
+
+// sharesRunner 判斷兩個 runner 字串是否有共同玩家（同一組人可直接續約）
+func sharesRunner(a, b string) bool {
+	names := make(map[string]bool)
+	for _, name := range utils.ParseRunnerNames(a) {
+		names[name] = true
+	}
+	for _, name := range utils.ParseRunnerNames(b) {
+		if names[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// claimMap 預約地圖；已被其他組預約且未到期時回傳 errMapClaimed（REST 與 WebSocket 共用）
+func claimMap(req ClaimMapRequest) (model.MapRecord, error) {
+	database := db.GetDB()
+	var record model.MapRecord
+	err := database.Where("map_name = ? AND difficulty = ?", req.MapName, req.Difficulty).
+		Order("status asc").First(&record).Error
+	if err != nil {
+		return record, err
+	}
+	if record.Status != model.StatusUnplayed && record.Status != model.StatusWIP {
+		return record, errMapCompleted
+	}
+
+	now := time.Now()
+	if claimActive(record, now) && !sharesRunner(record.Runner, req.Runner) {
+		return record, errMapClaimed
+	}
+
+	if err := applyClaim(&record, req.Runner, 0); err != nil {
+		return record, err
+	}
+
+	BroadcastUpdate(record)
+	return record, nil
+}
+
+// releaseClaim 將預約中的地圖還原為未完成
+func releaseClaim(record *model.MapRecord) error {
+	if err := applyTransition(record, model.ActionRelease, ""); err != nil {
+		return err
+	}
+	BroadcastUpdate(*record)
+	return nil
+}
+
+// findClaim 取得預約中的記錄
+func findClaim(c *gin.Context) (model.MapRecord, error) {
+	var record model.MapRecord
+	id, err := pathID(c)
+	if err != nil {
+		return record, err
+	}
+	if err := db.GetDB().First(&record, id).Error; err != nil {
+		return record, err
+	}
+	if record.Status != model.StatusWIP {
+		return record, errNotClaimed
+	}
+	return record, nil
+}
+
+// ClaimMap 預約地圖（同一組人重複呼叫即續約）
+func ClaimMap(c *gin.Context) {
+	var req ClaimMapRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	record, err := claimMap(req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	respondRecord(c, http.StatusOK, record)
+}
+
+// renewClaim 只延長到期時間（與版本號），不寫入狀態變更歷史
+func renewClaim(record *model.MapRecord) error {
+	expires := time.Now().Add(claimTTL())
+	record.ClaimExpiresAt = &expires
+	return saveRecord(db.GetDB(), record)
+}
+
+// RenewClaim 由預約者延長預約期限，需帶 ?runner= 且與預約者有共同玩家
+func RenewClaim(c *gin.Context) {
+	record, err := findClaim(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, record); err != nil {
+		respondError(c, err)
+		return
+	}
+	if !sharesRunner(record.Runner, c.Query("runner")) {
+		respondError(c, forbidden("only the claimers can renew this map"))
+		return
+	}
+
+	if err := renewClaim(&record); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	BroadcastUpdate(record)
+	respondRecord(c, http.StatusOK, record)
+}
+
+// ReleaseClaim 由預約者釋放地圖，需帶 ?runner= 且與預約者有共同玩家
+func ReleaseClaim(c *gin.Context) {
+	record, err := findClaim(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, record); err != nil {
+		respondError(c, err)
+		return
+	}
+	if !sharesRunner(record.Runner, c.Query("runner")) {
+		respondError(c, forbidden("only the claimers can release this map"))
+		return
+	}
+
+	if err := releaseClaim(&record); err != nil {
+		respondError(c, err)
+		return
+	}
+	respondRecord(c, http.StatusOK, record)
+}
+
+// AdminOverrideClaim 管理員強制指定預約者（不論目前由誰預約）
+func AdminOverrideClaim(c *gin.Context) {
+	var req AdminClaimRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	id, err := pathID(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var record model.MapRecord
+	if err := db.GetDB().First(&record, id).Error; err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, record); err != nil {
+		respondError(c, err)
+		return
+	}
+	if record.Status != model.StatusUnplayed && record.Status != model.StatusWIP {
+		respondError(c, errMapCompleted)
+		return
+	}
+
+	if err := applyClaim(&record, req.Runner, time.Duration(req.TTLMinutes)*time.Minute); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	BroadcastUpdate(record)
+	respondRecord(c, http.StatusOK, record)
+}
+
+// AdminReleaseClaim 管理員釋放預約
+func AdminReleaseClaim(c *gin.Context) {
+	record, err := findClaim(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, record); err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := releaseClaim(&record); err != nil {
+		respondError(c, err)
+		return
+	}
+	respondRecord(c, http.StatusOK, record)
+}
+
+// StartClaimSweeper 定期釋放已到期的預約
+func StartClaimSweeper() {
+	go func() {
+		ticker := time.NewTicker(claimSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			released, err := sweepExpiredClaims(time.Now())
+			if err != nil {
+				log.Println("Claims: failed to sweep:", err)
+				continue
+			}
+			if len(released) > 0 {
+				BroadcastUpdate(released...)
+			}
+		}
+	}()
+}
+
+// sweepExpiredClaims 釋放到期的預約並回傳已釋放的記錄。每個實例都會執行，
+// 以 pg_try_advisory_xact_lock 讓同一時間只有一個實例處理，其他實例直接跳過；
+// 期間被續約或修改的記錄 (errVersionConflict) 不視為失敗。
+func sweepExpiredClaims(now time.Time) ([]model.MapRecord, error) {
+	var released []model.MapRecord
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		var locked bool
+		if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", claimSweepLockKey).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if !locked {
+			return nil
+		}
+
+		var expired []model.MapRecord
+		if err := tx.Where("status = ? AND claim_expires_at <= ?", model.StatusWIP, now).Find(&expired).Error; err != nil {
+			return err
+		}
+		for i := range expired {
+			// 巢狀交易 = savepoint：單筆失敗不影響其他記錄
+			err := tx.Transaction(func(itx *gorm.DB) error {
+				return transitionTx(itx, &expired[i], model.ActionRelease, "", now)
+			})
+			switch {
+			case errors.Is(err, errVersionConflict):
+			case err != nil:
+				log.Printf("Claims: failed to release %d: %v", expired[i].ID, err)
+			default:
+				released = append(released, expired[i])
+			}
+		}
+		return nil
+	})
+	return released, err
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"DDNETONE/model"
+)
+
+// Error envelope — 所有錯誤回應都使用同一格式：
+//
+//	{"code": "validation_failed", "error": "invalid request body",
+//	 "details": [{"field": "score", "message": "must be at least 0"}]}
+//
+// "error" 保留為可讀訊息（既有客戶端只讀這個欄位），"code" 供程式判斷。
+
+// Error codes
+const (
+	CodeBadRequest        = "bad_request"
+	CodeValidationFailed  = "validation_failed"
+	CodeUnauthorized      = "unauthorized"
+	CodeForbidden         = "forbidden"
+	CodeNotFound          = "not_found"
+	CodeConflict          = "conflict"
+	CodeVersionConflict   = "version_conflict"
+	CodeInvalidTransition = "invalid_transition"
+	CodeInternal          = "internal_error"
+)
+
+// FieldError 描述單一欄位的驗證錯誤（field 為 JSON / query 參數名稱）
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// APIError 為回傳給客戶端的錯誤
+type APIError struct {
+	Status  int          `json:"-"`
+	Code    string       `json:"code"`
+	Message string       `json:"error"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string { return e.Message }
+
+func badRequest(message string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: message}
+}
+
+func validationFailed(details ...FieldError) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeValidationFailed, Message: "invalid request", Details: details}
+}
+
+func unauthorized(message string) *APIError {
+	return &APIError{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: message}
+}
+
+func forbidden(message string) *APIError {
+	return &APIError{Status: http.StatusForbidden, Code: CodeForbidden, Message: message}
+}
+
+func notFound(message string) *APIError {
+	return &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Message: message}
+}
+
+func conflict(message string) *APIError {
+	return &APIError{Status: http.StatusConflict, Code: CodeConflict, Message: message}
+}
+
+// internalError 記錄原因後回傳不含內部細節的 500
+func internalError(message string, cause error) *APIError {
+	if cause != nil {
+		log.Printf("%s: %v", message, cause)
+	}
+	return &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: message}
+}
+
+// toAPIError 將 service 內的已知錯誤對應到 HTTP 狀態碼；未知錯誤一律視為 500
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return notFound("record not found")
+	case errors.Is(err, errPresenceNotFound):
+		return notFound(err.Error())
+	case errors.Is(err, errVersionConflict):
+		return &APIError{Status: http.StatusConflict, Code: CodeVersionConflict, Message: err.Error()}
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return conflict("a record for this map and difficulty already exists")
+	case errors.Is(err, model.ErrInvalidTransition):
+		return &APIError{Status: http.StatusConflict, Code: CodeInvalidTransition, Message: err.Error()}
+	case errors.Is(err, errMapCompleted), errors.Is(err, errMapClaimed), errors.Is(err, errNotClaimed),
+		errors.Is(err, model.ErrMapRetired), errors.Is(err, errMergeBothPlayed):
+		return conflict(err.Error())
+	case errors.Is(err, model.ErrRunnerRequired):
+		return validationFailed(FieldError{Field: "runner", Message: "is required"})
+	default:
+		return internalError("internal server error", err)
+	}
+}
+
+// respondError 以錯誤格式回應
+func respondError(c *gin.Context, err error) {
+	apiErr := toAPIError(err)
+	c.AbortWithStatusJSON(apiErr.Status, apiErr)
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"DDNETONE/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// List filters shared by /api/maps and /api/admin/records — 可任意組合：
+//
+//	difficulty=BRUTAL,INSANE   難度（逗號分隔）
+//	status=2,4                 狀態（逗號分隔）
+//	runner=name                runner 內含該玩家（與 ParseRunnerNames 相同的切割規則）
+//	stars_min=1&stars_max=3    星數範圍（含）
+//	has_dummy=true|false
+//	retired=true|false
+//	from=&to=                  finish_time 區間 [from, to)，RFC3339 或 YYYY-MM-DD（依 tz）
+
+// recordSorts 為 MapRecord 列表可用的排序欄位
+var recordSorts = map[string]sortSpec[model.MapRecord]{
+	"score":  intSort("score", func(r model.MapRecord) int { return r.Score }),
+	"stars":  intSort("stars", func(r model.MapRecord) int { return r.Stars }),
+	"points": intSort("points", func(r model.MapRecord) int { return r.Points }),
+	"name":   stringSort("map_name", func(r model.MapRecord) string { return r.MapName }),
+	// 未完成的記錄沒有 finish_time，視為最早
+	"finish_time": timeSort("COALESCE(finish_time, '0001-01-01 00:00:00+00')", func(r model.MapRecord) time.Time {
+		if r.FinishTime == nil {
+			return time.Time{}
+		}
+		return *r.FinishTime
+	}),
+}
+
+func recordID(r model.MapRecord) uint { return r.ID }
+
+// applyRecordFilters 依查詢參數加上篩選條件
+func applyRecordFilters(c *gin.Context, q *gorm.DB) (*gorm.DB, error) {
+	if raw := c.Query("difficulty"); raw != "" && raw != "ALL" {
+		q = q.Where("difficulty IN ?", splitList(raw))
+	}
+
+	if raw := c.Query("status"); raw != "" {
+		var statuses []int
+		for _, part := range splitList(raw) {
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid status %q", part)
+			}
+			statuses = append(statuses, n)
+		}
+		q = q.Where("status IN ?", statuses)
+	}
+
+	if runner := strings.TrimSpace(c.Query("runner")); runner != "" {
+		q = q.Where(`EXISTS (SELECT 1 FROM unnest(string_to_array(replace(runner, '&', ','), ',')) AS r(name) WHERE btrim(r.name) = ?)`, runner)
+	}
+
+	for _, bound := range []struct{ param, op string }{{"stars_min", ">="}, {"stars_max", "<="}} {
+		if raw := c.Query(bound.param); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an integer", bound.param)
+			}
+			q = q.Where("stars "+bound.op+" ?", n)
+		}
+	}
+
+	if raw := c.Query("has_dummy"); raw != "" {
+		hasDummy, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("has_dummy must be true or false")
+		}
+		q = q.Where("has_dummy = ?", hasDummy)
+	}
+
+	if raw := c.Query("retired"); raw != "" {
+		retired, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("retired must be true or false")
+		}
+		q = q.Where("retired = ?", retired)
+	}
+
+	return applyTimeRange(c, q, "finish_time")
+}
+
+// applyTimeRange 加上 column 的 [from, to) 篩選
+func applyTimeRange(c *gin.Context, q *gorm.DB, column string) (*gorm.DB, error) {
+	from, to := c.Query("from"), c.Query("to")
+	if from == "" && to == "" {
+		return q, nil
+	}
+
+	loc, err := resolveTimezone(c)
+	if err != nil {
+		return nil, err
+	}
+	if from != "" {
+		t, err := parseTimeParam(from, time.Time{}, loc)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		q = q.Where(column+" >= ?", t)
+	}
+	if to != "" {
+		t, err := parseTimeParam(to, time.Time{}, loc)
+		if err != nil {
+			return nil, fmt.Errorf("to: %w", err)
+		}
+		q = q.Where(column+" < ?", t)
+	}
+	return q, nil
+}
+
+// splitList 切割逗號分隔的參數並去除空白
+func splitList(raw string) []string {
+	var parts []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
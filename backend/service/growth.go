@@ -1,19 +1,109 @@
 package service
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"DDNETONE/db"
 	"DDNETONE/model"
+	"DDNETONE/utils"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// growthBuckets 為 GET /api/growth 可用的降採樣區間 (對應 date_trunc 的單位)
+var growthBuckets = map[string]bool{
+	"hour": true,
+	"day":  true,
+	"week": true,
+}
+
+// parseTimeParam 解析 RFC3339 或 YYYY-MM-DD 格式的查詢參數（日期以 loc 解讀），空字串回傳 fallback
+func parseTimeParam(raw string, fallback time.Time, loc *time.Location) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", raw, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q (expected RFC3339 or YYYY-MM-DD)", raw)
+	}
+	return t, nil
+}
+
+// buildGrowth returns raw growth rows within [from, to) (shared by API and SSE).
+func buildGrowth(from, to time.Time) ([]model.GrowthData, error) {
+	growth := []model.GrowthData{}
+	err := db.GetDB().Where("timestamp >= ? AND timestamp < ?", from, to).Order("timestamp asc, id asc").Find(&growth).Error
+	return growth, err
+}
+
+// buildGrowthBuckets downsamples growth rows in SQL. Points/Maps are cumulative,
+// so each bucket keeps its maximum value; Count is the number of snapshots.
+// Bucket boundaries (day/week starts) follow loc.
+func buildGrowthBuckets(from, to time.Time, bucket string, loc *time.Location) ([]model.GrowthBucket, error) {
+	buckets := []model.GrowthBucket{}
+	err := db.GetDB().Model(&model.GrowthData{}).
+		Select("date_trunc(?, timestamp AT TIME ZONE ?) AT TIME ZONE ? AS timestamp, MAX(hours) AS hours, MAX(points) AS points, MAX(maps) AS maps, COUNT(*) AS count",
+			bucket, loc.String(), loc.String()).
+		Where("timestamp >= ? AND timestamp < ?", from, to).
+		Group("1").
+		Order("1 asc").
+		Scan(&buckets).Error
+	return buckets, err
+}
+
+// GetGrowth 回傳成長曲線
+// Query: from / to (RFC3339 或 YYYY-MM-DD，預設過去 7 天)，bucket=hour|day|week 時回傳降採樣結果，tz 為 IANA 時區
 func GetGrowth(c *gin.Context) {
-	var growth []model.GrowthData
-	sevenDaysAgo := time.Now().AddDate(0, 0, -7).Format(time.RFC3339)
-	db.GetDB().Where("timestamp >= ?", sevenDaysAgo).Order("id asc").Find(&growth)
-	c.JSON(http.StatusOK, growth)
+	loc, err := resolveTimezone(c)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+
+	now := time.Now()
+	from, err := parseTimeParam(c.Query("from"), now.AddDate(0, 0, -7), loc)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+	to, err := parseTimeParam(c.Query("to"), now, loc)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+	if !from.Before(to) {
+		respondError(c, badRequest("from must be before to"))
+		return
+	}
+
+	bucket := c.Query("bucket")
+	if bucket == "" {
+		growth, err := buildGrowth(from, to)
+		if err != nil {
+			respondError(c, internalError("failed to load growth", err))
+			return
+		}
+		c.JSON(http.StatusOK, growth)
+		return
+	}
+	if !growthBuckets[bucket] {
+		respondError(c, badRequest("bucket must be one of hour, day, week"))
+		return
+	}
+
+	buckets, err := buildGrowthBuckets(from, to, bucket, loc)
+	if err != nil {
+		respondError(c, internalError("failed to load growth", err))
+		return
+	}
+	c.JSON(http.StatusOK, buckets)
 }
 
 type DailyActivity struct {
@@ -22,8 +112,14 @@ type DailyActivity struct {
 	Score int    `json:"score"`
 }
 
-// GetDailyActivity 回傳每日完成地圖數與分數增量（過去一年）
+// GetDailyActivity 回傳每日完成地圖數與分數增量（過去一年），日期依 ?tz= 時區切分
 func GetDailyActivity(c *gin.Context) {
+	loc, err := resolveTimezone(c)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+
 	oneYearAgo := time.Now().AddDate(-1, 0, 0)
 
 	// 取得完成記錄，按日期彙整
@@ -34,12 +130,16 @@ func GetDailyActivity(c *gin.Context) {
 	}
 
 	var rows []row
-	db.GetDB().Model(&model.MapRecord{}).
-		Select("DATE(finish_time AT TIME ZONE 'Asia/Taipei') AS date, COUNT(*) AS maps, SUM(score) AS score").
-		Where("status = 2 AND finish_time >= ?", oneYearAgo).
-		Group("DATE(finish_time AT TIME ZONE 'Asia/Taipei')").
+	err = db.GetDB().Model(&model.MapRecord{}).
+		Select("TO_CHAR(finish_time AT TIME ZONE ?, 'YYYY-MM-DD') AS date, COUNT(*) AS maps, SUM(score) AS score", loc.String()).
+		Where("status IN ? AND finish_time >= ?", model.CompletedStatuses, oneYearAgo).
+		Group("1").
 		Order("date asc").
-		Scan(&rows)
+		Scan(&rows).Error
+	if err != nil {
+		respondError(c, internalError("failed to load daily activity", err))
+		return
+	}
 
 	result := make([]DailyActivity, len(rows))
 	for i, r := range rows {
@@ -49,18 +149,66 @@ func GetDailyActivity(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+// ActivityHeatmap 為 7×24 的活躍矩陣：[weekday][hour]，weekday 0 為星期日
+type ActivityHeatmap struct {
+	Timezone    string     `json:"timezone"`
+	Completions [7][24]int `json:"completions"`
+	Points      [7][24]int `json:"points"`
+}
+
+// GetActivityHeatmap 依 finish_time 統計各星期/小時的完成數與分數
+// Query: player (單一玩家), difficulty, tz
+func GetActivityHeatmap(c *gin.Context) {
+	loc, err := resolveTimezone(c)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+
+	query := db.GetDB().Model(&model.MapRecord{}).Where("status IN ? AND finish_time IS NOT NULL", model.CompletedStatuses)
+	if difficulty := c.Query("difficulty"); difficulty != "" && difficulty != "ALL" {
+		query = query.Where("difficulty = ?", difficulty)
+	}
+
+	player := c.Query("player")
+	if player != "" {
+		// 先以 LIKE 粗篩，再用 ParseRunnerNames 精確比對名稱
+		query = query.Where("runner LIKE ?", "%"+player+"%")
+	}
+
+	var records []model.MapRecord
+	if err := query.Select("runner, score, finish_time").Find(&records).Error; err != nil {
+		respondError(c, internalError("failed to load records", err))
+		return
+	}
+
+	heatmap := ActivityHeatmap{Timezone: loc.String()}
+	for _, r := range records {
+		if player != "" && !slices.Contains(utils.ParseRunnerNames(r.Runner), player) {
+			continue
+		}
+		t := r.FinishTime.In(loc)
+		heatmap.Completions[t.Weekday()][t.Hour()]++
+		heatmap.Points[t.Weekday()][t.Hour()] += r.Score
+	}
+
+	c.JSON(http.StatusOK, heatmap)
+}
+
 type MilestoneResult struct {
-	Target    int    `json:"target"`
-	Timestamp string `json:"timestamp"`
-	Maps      int    `json:"maps"`
+	Target    int       `json:"target"`
+	Timestamp time.Time `json:"timestamp"`
+	Maps      int       `json:"maps"`
 }
 
 // buildMilestones computes map milestones (shared by API and SSE).
-func buildMilestones() []MilestoneResult {
+func buildMilestones() ([]MilestoneResult, error) {
 	const TARGET_MAPS = 2403
 
 	var records []model.GrowthData
-	db.GetDB().Order("maps asc, id asc").Find(&records)
+	if err := db.GetDB().Order("maps asc, id asc").Find(&records).Error; err != nil {
+		return nil, err
+	}
 
 	results := []MilestoneResult{}
 	target := 100
@@ -77,19 +225,26 @@ func buildMilestones() []MilestoneResult {
 			break
 		}
 	}
-	return results
+	return results, nil
 }
 
 func GetMilestones(c *gin.Context) {
-	c.JSON(http.StatusOK, buildMilestones())
+	milestones, err := buildMilestones()
+	if err != nil {
+		respondError(c, internalError("failed to load milestones", err))
+		return
+	}
+	c.JSON(http.StatusOK, milestones)
 }
 
 // buildScoreMilestones computes score milestones (shared by API and SSE).
-func buildScoreMilestones() []MilestoneResult {
+func buildScoreMilestones() ([]MilestoneResult, error) {
 	const SCORE_STEP = 1000
 
 	var records []model.GrowthData
-	db.GetDB().Order("points asc, id asc").Find(&records)
+	if err := db.GetDB().Order("points asc, id asc").Find(&records).Error; err != nil {
+		return nil, err
+	}
 
 	results := []MilestoneResult{}
 	target := SCORE_STEP
@@ -103,21 +258,28 @@ func buildScoreMilestones() []MilestoneResult {
 			target += SCORE_STEP
 		}
 	}
-	return results
+	return results, nil
 }
 
 func GetScoreMilestones(c *gin.Context) {
-	c.JSON(http.StatusOK, buildScoreMilestones())
+	milestones, err := buildScoreMilestones()
+	if err != nil {
+		respondError(c, internalError("failed to load score milestones", err))
+		return
+	}
+	c.JSON(http.StatusOK, milestones)
 }
 
-func RecordGrowthSnapshot(score int, maps int, runner string, map_name string, map_points int) {
-	database := db.GetDB()
+// RecordGrowthSnapshot 在 tx 內新增一筆成長快照（分數與完成數未變時略過）
+func RecordGrowthSnapshot(tx *gorm.DB, score int, maps int, runner string, map_name string, map_points int) error {
 	var firstRecord model.MapRecord
 	var startTime time.Time
 
-	err := database.Where("status = 2 AND finish_time IS NOT NULL").Order("finish_time asc").First(&firstRecord).Error
+	err := tx.Where("status IN ? AND finish_time IS NOT NULL", model.CompletedStatuses).Order("finish_time asc").First(&firstRecord).Error
 	if err == nil && firstRecord.FinishTime != nil {
 		startTime = *firstRecord.FinishTime
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
 	} else {
 		startTime = time.Now()
 	}
@@ -128,10 +290,12 @@ func RecordGrowthSnapshot(score int, maps int, runner string, map_name string, m
 	}
 
 	var lastGrowth model.GrowthData
-	if err := database.Order("id desc").First(&lastGrowth).Error; err == nil {
+	if err := tx.Order("id desc").First(&lastGrowth).Error; err == nil {
 		if lastGrowth.Points == score && lastGrowth.Maps == maps {
-			return
+			return nil
 		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
 	}
 
 	newGrowth := model.GrowthData{
@@ -141,8 +305,8 @@ func RecordGrowthSnapshot(score int, maps int, runner string, map_name string, m
 		Runner:    runner,
 		MapName:   map_name,
 		MapPoints: map_points,
-		Timestamp: time.Now().Format(time.RFC3339),
+		Timestamp: time.Now(),
 	}
 
-	database.Create(&newGrowth)
+	return tx.Create(&newGrowth).Error
 }
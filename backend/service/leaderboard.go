@@ -0,0 +1,370 @@
+package service
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"DDNETONE/db"
+	"DDNETONE/model"
+	"DDNETONE/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Leaderboard index — completed records are kept in memory with their runner
+// names already parsed, so /api/leaderboard and SSE broadcasts never reload
+// map_records. Every MapRecord that passes through the broadcaster (local
+// writes and peer NOTIFYs) updates the index; a periodic consistency check
+// rebuilds it from the DB if it drifted (e.g. after build_db.py imports).
+
+const leaderboardCheckInterval = 10 * time.Minute
+
+// leaderboardEntry 為單筆已完成記錄對排行榜的貢獻；version 為記錄的 MapRecord.Version
+type leaderboardEntry struct {
+	names   []string
+	score   int
+	finish  *time.Time
+	version int
+}
+
+func newLeaderboardEntry(r model.MapRecord) (leaderboardEntry, bool) {
+	if !model.IsCompleted(r.Status) || r.Score <= 0 {
+		return leaderboardEntry{}, false
+	}
+	return leaderboardEntry{names: utils.ParseRunnerNames(r.Runner), score: r.Score, finish: r.FinishTime, version: r.Version}, true
+}
+
+func (e leaderboardEntry) equal(o leaderboardEntry) bool {
+	if e.score != o.score || !slices.Equal(e.names, o.names) {
+		return false
+	}
+	if e.finish == nil || o.finish == nil {
+		return e.finish == o.finish
+	}
+	return e.finish.Equal(*o.finish)
+}
+
+type leaderboardIndex struct {
+	mu       sync.RWMutex
+	loaded   bool
+	entries  map[uint]leaderboardEntry // MapRecord.ID -> 貢獻
+	others   map[uint]int              // 不計入排行榜的記錄 MapRecord.ID -> Version（已刪除為 math.MaxInt）
+	players  map[string]model.Player
+	modified time.Time
+}
+
+var leaderboardCache = &leaderboardIndex{}
+
+// leaderboardSnapshot 為從 DB 讀出的完整索引內容
+type leaderboardSnapshot struct {
+	entries map[uint]leaderboardEntry
+	others  map[uint]int
+	players map[string]model.Player
+}
+
+// loadLeaderboardIndex 從 DB 讀出完整索引（不計入排行榜的記錄只讀版本號）
+func loadLeaderboardIndex() (leaderboardSnapshot, error) {
+	database := db.GetDB()
+	snap := leaderboardSnapshot{}
+
+	var records []model.MapRecord
+	if err := database.Where("status IN ? AND score > 0", model.CompletedStatuses).Find(&records).Error; err != nil {
+		return snap, err
+	}
+	snap.entries = make(map[uint]leaderboardEntry, len(records))
+	for _, r := range records {
+		if e, ok := newLeaderboardEntry(r); ok {
+			snap.entries[r.ID] = e
+		}
+	}
+
+	var others []model.MapRecord
+	if err := database.Select("id", "version").
+		Where("NOT (status IN ? AND score > 0)", model.CompletedStatuses).Find(&others).Error; err != nil {
+		return snap, err
+	}
+	snap.others = make(map[uint]int, len(others))
+	for _, r := range others {
+		snap.others[r.ID] = r.Version
+	}
+
+	var players []model.Player
+	if err := database.Find(&players).Error; err != nil {
+		return snap, err
+	}
+	snap.players = make(map[string]model.Player, len(players))
+	for _, p := range players {
+		snap.players[p.Name] = p
+	}
+	return snap, nil
+}
+
+// rebuild 以 DB 內容完整重建索引
+func (ix *leaderboardIndex) rebuild() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.rebuildLocked()
+}
+
+func (ix *leaderboardIndex) rebuildLocked() error {
+	snap, err := loadLeaderboardIndex()
+	if err != nil {
+		return err
+	}
+	ix.entries, ix.others, ix.players = snap.entries, snap.others, snap.players
+	ix.loaded = true
+	ix.modified = time.Now()
+	return nil
+}
+
+// ensureLoaded 第一次使用時建立索引
+func (ix *leaderboardIndex) ensureLoaded() error {
+	ix.mu.RLock()
+	loaded := ix.loaded
+	ix.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.loaded {
+		return nil
+	}
+	return ix.rebuildLocked()
+}
+
+// versionOf 回傳索引中記錄的版本（不認識的記錄為 0）。Caller holds ix.mu.
+func (ix *leaderboardIndex) versionOf(id uint) int {
+	if e, ok := ix.entries[id]; ok {
+		return e.version
+	}
+	return ix.others[id]
+}
+
+// apply 以記錄的最新內容更新索引（未完成或 score 為 0 的記錄會被移除），
+// 回傳比索引新的記錄。廣播的排入順序不一定等於 commit 順序（並行的寫入、
+// 其他實例重新讀取的記錄），版本不比索引新的記錄直接略過。
+func (ix *leaderboardIndex) apply(records []model.MapRecord) []model.MapRecord {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.loaded {
+		// 尚未建立時下次使用會從 DB 讀取，不需要增量更新
+		return records
+	}
+
+	fresh := make([]model.MapRecord, 0, len(records))
+	changed := false
+	for _, r := range records {
+		if r.Version <= ix.versionOf(r.ID) {
+			continue
+		}
+		fresh = append(fresh, r)
+
+		old, had := ix.entries[r.ID]
+		e, ok := newLeaderboardEntry(r)
+		if ok {
+			delete(ix.others, r.ID)
+			ix.entries[r.ID] = e
+			changed = changed || !had || !old.equal(e)
+			continue
+		}
+		ix.others[r.ID] = r.Version
+		if had {
+			delete(ix.entries, r.ID)
+			changed = true
+		}
+	}
+	if changed {
+		ix.modified = time.Now()
+	}
+	return fresh
+}
+
+// forget 移除已刪除的記錄；ID 不會重複使用，之後排入的舊版本一律略過
+func (ix *leaderboardIndex) forget(ids ...uint) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if !ix.loaded {
+		return
+	}
+	changed := false
+	for _, id := range ids {
+		if _, ok := ix.entries[id]; ok {
+			delete(ix.entries, id)
+			changed = true
+		}
+		ix.others[id] = math.MaxInt
+	}
+	if changed {
+		ix.modified = time.Now()
+	}
+}
+
+// activity 依 loc 時區彙整每位玩家的分數、完成數與完成日期
+func (ix *leaderboardIndex) activity(loc *time.Location) (map[string]*playerActivity, map[string]model.Player, time.Time, error) {
+	if err := ix.ensureLoaded(); err != nil {
+		return nil, nil, time.Time{}, err
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	activity := make(map[string]*playerActivity)
+	for _, e := range ix.entries {
+		for _, name := range e.names {
+			a, ok := activity[name]
+			if !ok {
+				a = &playerActivity{days: make(map[time.Time]struct{})}
+				activity[name] = a
+			}
+			a.score += float64(e.score)
+			a.count++
+			if e.finish != nil {
+				a.days[civilDay(*e.finish, loc)] = struct{}{}
+			}
+		}
+	}
+	return activity, ix.players, ix.modified, nil
+}
+
+// LeaderboardCheck 為一致性檢查結果（索引與 DB 比對）
+type LeaderboardCheck struct {
+	Consistent     bool   `json:"consistent"`
+	Entries        int    `json:"entries"`
+	Missing        []uint `json:"missing"` // DB 有、索引沒有
+	Stale          []uint `json:"stale"`   // 內容不同
+	Extra          []uint `json:"extra"`   // 索引有、DB 沒有
+	PlayersChanged bool   `json:"players_changed"`
+	Rebuilt        bool   `json:"rebuilt"`
+}
+
+// check 比對索引與 DB；repair 為 true 且不一致時以 DB 內容取代索引
+func (ix *leaderboardIndex) check(repair bool) (LeaderboardCheck, error) {
+	if err := ix.ensureLoaded(); err != nil {
+		return LeaderboardCheck{}, err
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	snap, err := loadLeaderboardIndex()
+	if err != nil {
+		return LeaderboardCheck{}, err
+	}
+	entries, players := snap.entries, snap.players
+
+	result := LeaderboardCheck{Entries: len(entries), Missing: []uint{}, Stale: []uint{}, Extra: []uint{}}
+	for id, e := range entries {
+		old, ok := ix.entries[id]
+		if !ok {
+			result.Missing = append(result.Missing, id)
+		} else if !old.equal(e) {
+			result.Stale = append(result.Stale, id)
+		}
+	}
+	for id := range ix.entries {
+		if _, ok := entries[id]; !ok {
+			result.Extra = append(result.Extra, id)
+		}
+	}
+	if len(players) != len(ix.players) {
+		result.PlayersChanged = true
+	} else {
+		for name, p := range players {
+			if ix.players[name] != p {
+				result.PlayersChanged = true
+				break
+			}
+		}
+	}
+	slices.Sort(result.Missing)
+	slices.Sort(result.Stale)
+	slices.Sort(result.Extra)
+	result.Consistent = len(result.Missing) == 0 && len(result.Stale) == 0 && len(result.Extra) == 0 && !result.PlayersChanged
+
+	if repair && !result.Consistent {
+		ix.entries, ix.others, ix.players = snap.entries, snap.others, snap.players
+		ix.modified = time.Now()
+		result.Rebuilt = true
+	}
+	return result, nil
+}
+
+// StartLeaderboardChecker 定期檢查索引一致性，不一致時重建並廣播
+func StartLeaderboardChecker() {
+	go func() {
+		ticker := time.NewTicker(leaderboardCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			result, err := leaderboardCache.check(true)
+			if err != nil {
+				log.Println("Leaderboard: consistency check failed:", err)
+				continue
+			}
+			if result.Rebuilt {
+				log.Printf("Leaderboard: index drifted (missing=%d stale=%d extra=%d players=%v), rebuilt",
+					len(result.Missing), len(result.Stale), len(result.Extra), result.PlayersChanged)
+				sseBroadcaster.enqueue(pendingChange{aggregates: true})
+			}
+		}
+	}()
+}
+
+// leaderboardETag 以內容雜湊作為 ETag（跨實例一致）
+func leaderboardETag(stats []model.PlayerStats) (string, error) {
+	body, err := json.Marshal(stats)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`, nil
+}
+
+// notModified 依 If-None-Match / If-Modified-Since 判斷是否可回 304
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		return inm == etag || inm == "*"
+	}
+	if ims := c.GetHeader("If-Modified-Since"); ims != "" {
+		if t, err := http.ParseTime(ims); err == nil {
+			return !lastModified.Truncate(time.Second).After(t)
+		}
+	}
+	return false
+}
+
+// CheckLeaderboard 回傳索引與 DB 的一致性檢查結果
+// Query: repair=true 時不一致就重建
+func CheckLeaderboard(c *gin.Context) {
+	repair := c.Query("repair") == "true"
+	result, err := leaderboardCache.check(repair)
+	if err != nil {
+		respondError(c, internalError("failed to check leaderboard", err))
+		return
+	}
+	if result.Rebuilt {
+		BroadcastUpdate()
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// RebuildLeaderboard 從 DB 完整重建排行榜索引
+func RebuildLeaderboard(c *gin.Context) {
+	if err := leaderboardCache.rebuild(); err != nil {
+		respondError(c, internalError("failed to rebuild leaderboard", err))
+		return
+	}
+	BroadcastUpdate()
+
+	leaderboardCache.mu.RLock()
+	entries := len(leaderboardCache.entries)
+	leaderboardCache.mu.RUnlock()
+	c.JSON(http.StatusOK, gin.H{"rebuilt": true, "entries": entries})
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"DDNETONE/db"
+	"DDNETONE/model"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// applyTransition runs a lifecycle action on record and persists both the record
+// and its MapTransition row in one transaction (new records are created first).
+func applyTransition(record *model.MapRecord, action string, runner string) error {
+	return db.GetDB().Transaction(func(tx *gorm.DB) error {
+		return transitionTx(tx, record, action, runner, time.Now())
+	})
+}
+
+// transitionTx is applyTransition inside an existing transaction.
+func transitionTx(tx *gorm.DB, record *model.MapRecord, action string, runner string, now time.Time) error {
+	summaryChanged, err := transitionRecord(tx, record, action, runner, now)
+	if err != nil {
+		return err
+	}
+
+	// 新增地圖或完成狀態改變時，總覽需在同一交易內更新
+	if summaryChanged {
+		if _, err := refreshSummary(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transitionRecord persists the transition without refreshing the summary; it
+// reports whether the summary is affected (bulk operations refresh it once).
+func transitionRecord(tx *gorm.DB, record *model.MapRecord, action string, runner string, now time.Time) (bool, error) {
+	created := record.ID == 0
+	transition, err := record.Transition(action, runner, now)
+	if err != nil {
+		return false, err
+	}
+	if err := saveRecord(tx, record); err != nil {
+		return false, err
+	}
+	if err := recordTransition(tx, *record, transition); err != nil {
+		return false, err
+	}
+	return created || model.IsCompleted(transition.FromStatus) != model.IsCompleted(transition.ToStatus), nil
+}
+
+// recordTransition writes the MapTransition row for a record that was already
+// transitioned and saved (callers that combine other edits with a transition
+// save the record once themselves).
+func recordTransition(tx *gorm.DB, record model.MapRecord, transition model.MapTransition) error {
+	transition.MapRecordID = record.ID
+	return tx.Create(&transition).Error
+}
+
+// errVersionConflict 表示記錄已被其他請求修改（If-Match 不符或並行寫入）
+var errVersionConflict = errors.New("record was modified by another request")
+
+// saveRecord 新增或以版本條件更新記錄；版本不符時回傳 errVersionConflict
+func saveRecord(tx *gorm.DB, record *model.MapRecord) error {
+	if record.ID == 0 {
+		record.Version = 1
+		return tx.Create(record).Error
+	}
+
+	next := *record
+	next.Version++
+	result := tx.Model(&model.MapRecord{}).
+		Where("id = ? AND version = ?", record.ID, record.Version).
+		Select("*").Updates(&next)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errVersionConflict
+	}
+	record.Version = next.Version
+	return nil
+}
+
+// recordETag 以版本號作為記錄的 ETag
+func recordETag(record model.MapRecord) string {
+	return `"` + strconv.Itoa(record.Version) + `"`
+}
+
+// checkIfMatch 比對 If-Match header 與記錄版本；未帶 header 時不檢查
+func checkIfMatch(c *gin.Context, record model.MapRecord) error {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		return nil
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" && record.ID != 0 {
+			return nil
+		}
+		tag = strings.Trim(strings.TrimPrefix(tag, "W/"), `"`)
+		if v, err := strconv.Atoi(tag); err == nil && v == record.Version && record.ID != 0 {
+			return nil
+		}
+	}
+	return errVersionConflict
+}
+
+// respondRecord 回傳記錄並附帶 ETag
+func respondRecord(c *gin.Context, status int, record model.MapRecord) {
+	c.Header("ETag", recordETag(record))
+	c.JSON(status, record)
+}
+
+// GetRecordTransitions 回傳單一記錄的狀態變更歷史
+func GetRecordTransitions(c *gin.Context) {
+	id, err := pathID(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var transitions []model.MapTransition
+	if err := db.GetDB().Where("map_record_id = ?", id).Order("created_at asc, id asc").Find(&transitions).Error; err != nil {
+		respondError(c, internalError("failed to load transitions", err))
+		return
+	}
+	c.JSON(http.StatusOK, transitions)
+}
+
+// VerifyRecord 將已完成的記錄標記為已驗證
+func VerifyRecord(c *gin.Context) {
+	id, err := pathID(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	var record model.MapRecord
+	if err := db.GetDB().First(&record, id).Error; err != nil {
+		respondError(c, err)
+		return
+	}
+	if err := checkIfMatch(c, record); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if err := applyTransition(&record, model.ActionVerify, ""); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	BroadcastUpdate(record)
+	respondRecord(c, http.StatusOK, record)
+}
@@ -1,92 +1,147 @@
 package service
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"DDNETONE/db"
 	"DDNETONE/model"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// GetMaps 回傳地圖記錄（分頁、排序與篩選見 pagination.go、filter.go）
+// 預設依 score 由高到低；paginate=false 回傳完整陣列
 func GetMaps(c *gin.Context) {
-	difficulty := c.Query("difficulty")
-	var maps []model.MapRecord
-	query := db.GetDB().Model(&model.MapRecord{})
+	page, err := parsePage(c, recordSorts, "score", true)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+	query, err := applyRecordFilters(c, db.GetDB().Model(&model.MapRecord{}))
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
 
-	if difficulty != "" {
-		query = query.Where("difficulty = ?", difficulty)
+	result, err := paginate(query, page, recordSorts, recordID)
+	if err != nil {
+		respondError(c, internalError("failed to load maps", err))
+		return
 	}
-	query.Order("score desc").Find(&maps)
-	c.JSON(http.StatusOK, maps)
+	respondPage(c, page, result)
 }
 
+// GetMapOptions 回傳未完成且未退役的地圖；預約中 (status 1) 的地圖附帶 runner（預約者）與 claim_expires_at
 func GetMapOptions(c *gin.Context) {
 	difficulty := c.Query("difficulty")
 	var maps []model.MapRecord
-	q := db.GetDB()
+	q := db.GetDB().Where("NOT retired")
 	if difficulty != "" && difficulty != "ALL" {
-		q = q.Where("difficulty = ? AND status != 2", difficulty)
+		q = q.Where("difficulty = ? AND status NOT IN ?", difficulty, model.CompletedStatuses)
 	} else {
-		q = q.Where("status != 2")
+		q = q.Where("status NOT IN ?", model.CompletedStatuses)
+	}
+	if err := q.Order("map_name asc").Find(&maps).Error; err != nil {
+		respondError(c, internalError("failed to load map options", err))
+		return
 	}
-	q.Order("map_name asc").Find(&maps)
 	c.JSON(http.StatusOK, maps)
 }
 
+// CreateRecordRequest 為提交紀錄的內容（驗證規則見 validate.go）
+type CreateRecordRequest struct {
+	MapName    string `json:"map_name" binding:"required,max=128"`
+	Difficulty string `json:"difficulty" binding:"required,difficulty"`
+	Runner     string `json:"runner" binding:"max=128,runners"`
+	Score      int    `json:"score" binding:"min=0"`
+	Points     int    `json:"points" binding:"min=0"`
+	Stars      int    `json:"stars" binding:"min=0,max=5"`
+	Note       string `json:"note" binding:"max=500"`
+	Status     int    `json:"status" binding:"oneof=1 2 3"`
+	HasDummy   bool   `json:"has_dummy"`
+}
+
+// CreateRecord 提交完成紀錄 (status 2)、已加載 (status 3) 或進行中 (status 1，等同預約)
 func CreateRecord(c *gin.Context) {
-	var newRecord model.MapRecord
-	if err := c.ShouldBindJSON(&newRecord); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var newRecord CreateRecordRequest
+	if err := bindJSON(c, &newRecord); err != nil {
+		respondError(c, err)
 		return
 	}
 
-	now := time.Now()
-	database := db.GetDB()
-	var existingRecord model.MapRecord
-
-	result := database.Where("map_name = ? AND difficulty = ? AND status != 2", newRecord.MapName, newRecord.Difficulty).First(&existingRecord)
-
-	if result.Error == nil {
-		// --- A. Update ---
-		existingRecord.Runner = newRecord.Runner
-		existingRecord.Note = newRecord.Note
-		existingRecord.FinishTime = &now
-		existingRecord.Status = newRecord.Status
-		existingRecord.HasDummy = newRecord.HasDummy
-		existingRecord.Score = newRecord.Score
-
-		if err := database.Save(&existingRecord).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update record"})
+	if newRecord.Status == model.StatusWIP {
+		record, err := claimMap(ClaimMapRequest{
+			MapName:    newRecord.MapName,
+			Difficulty: newRecord.Difficulty,
+			Runner:     newRecord.Runner,
+		})
+		if err != nil {
+			respondError(c, err)
 			return
 		}
+		respondRecord(c, http.StatusOK, record)
+		return
+	}
 
-		UpdateGlobalSummary()
-		// 呼叫 Growth Snapshot (需先取得最新 Summary 數據)
-		triggerSnapshot(existingRecord.Runner, existingRecord.MapName, existingRecord.Score)
-
-		BroadcastUpdate()
-		c.JSON(http.StatusOK, existingRecord)
+	action := model.ActionComplete
+	if newRecord.Status == model.StatusLoaded {
+		action = model.ActionLoad
+	}
 
-	} else {
-		// --- B. Create ---
-		if err := database.Create(&newRecord).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create record"})
-			return
+	var record model.MapRecord
+	status := http.StatusOK
+
+	// 查詢、狀態變更、總覽與成長快照在同一交易內完成；
+	// 並行提交同一張地圖時由版本條件或唯一鍵擋下後者 (409)
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("map_name = ? AND difficulty = ?", newRecord.MapName, newRecord.Difficulty).
+			First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// --- 尚未登錄的地圖：以提交內容建立 ---
+			record = model.MapRecord{
+				MapName:    newRecord.MapName,
+				Difficulty: newRecord.Difficulty,
+				Points:     newRecord.Points,
+				Stars:      newRecord.Stars,
+			}
+			status = http.StatusCreated
+		} else if err != nil {
+			return err
+		} else if err := checkIfMatch(c, record); err != nil {
+			return err
 		}
 
-		UpdateGlobalSummary()
-		triggerSnapshot(newRecord.Runner, newRecord.MapName, newRecord.Score)
+		record.Note = newRecord.Note
+		record.HasDummy = newRecord.HasDummy
+		if action == model.ActionComplete {
+			record.Score = newRecord.Score
+		}
 
-		BroadcastUpdate()
-		c.JSON(http.StatusCreated, newRecord)
+		if err := transitionTx(tx, &record, action, newRecord.Runner, time.Now()); err != nil {
+			return err
+		}
+		// 已加載不計入完成數，因此不寫入成長快照
+		if action == model.ActionLoad {
+			return nil
+		}
+		return triggerSnapshot(tx, record.Runner, record.MapName, record.Score)
+	})
+	if err != nil {
+		respondError(c, err)
+		return
 	}
+
+	BroadcastUpdate(record)
+	respondRecord(c, status, record)
 }
 
-func triggerSnapshot(runner string, map_name string, map_points int) {
-	var summary model.Summary
-	// 取得剛才 UpdateGlobalSummary 更新後的最新資料
-	if err := db.GetDB().Last(&summary).Error; err == nil {
-		RecordGrowthSnapshot(summary.CurrentScore, summary.CompletedMaps, runner, map_name, map_points)
+// triggerSnapshot 以交易內剛更新的總覽寫入 Growth Snapshot
+func triggerSnapshot(tx *gorm.DB, runner string, map_name string, map_points int) error {
+	summary, err := latestSummary(tx)
+	if err != nil {
+		return err
 	}
+	return RecordGrowthSnapshot(tx, summary.CurrentScore, summary.CompletedMaps, runner, map_name, map_points)
 }
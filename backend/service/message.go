@@ -9,23 +9,63 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// messageSorts 為留言列表可用的排序欄位
+var messageSorts = map[string]sortSpec[model.Message]{
+	"created_at": timeSort("created_at", func(m model.Message) time.Time { return m.CreatedAt }),
+}
+
+// GetMessages 回傳留言，預設由新到舊
+// Query: user, from, to (created_at 區間) 與分頁參數；paginate=false 回傳完整陣列
 func GetMessages(c *gin.Context) {
+	page, err := parsePage(c, messageSorts, "created_at", true)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+	query := db.GetDB().Model(&model.Message{})
+	if user := c.Query("user"); user != "" {
+		query = query.Where(`"user" = ?`, user)
+	}
+	query, err = applyTimeRange(c, query, "created_at")
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+
+	result, err := paginate(query, page, messageSorts, func(m model.Message) uint { return m.ID })
+	if err != nil {
+		respondError(c, internalError("failed to load messages", err))
+		return
+	}
+	respondPage(c, page, result)
+}
 
-	var messages []model.Message
-	db.GetDB().Order("created_at desc").Find(&messages)
-	c.JSON(http.StatusOK, messages)
+// PostMessageRequest 為留言內容（REST 與 WebSocket 共用）
+type PostMessageRequest struct {
+	User    string `json:"user" binding:"required,max=32"`
+	Content string `json:"content" binding:"required,max=500"`
 }
 
 func CreateMessage(c *gin.Context) {
-	var msg model.Message
-	if err := c.ShouldBindJSON(&msg); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req PostMessageRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondError(c, err)
 		return
 	}
-	msg.CreatedAt = time.Now()
-	if err := db.GetDB().Create(&msg).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post message"})
+	msg := model.Message{User: req.User, Content: req.Content}
+	if err := postMessage(&msg); err != nil {
+		respondError(c, internalError("failed to post message", err))
 		return
 	}
 	c.JSON(http.StatusCreated, msg)
 }
+
+// postMessage 建立留言並通知訂閱者（REST 與 WebSocket 共用）
+func postMessage(msg *model.Message) error {
+	msg.CreatedAt = time.Now()
+	if err := db.GetDB().Create(msg).Error; err != nil {
+		return err
+	}
+	BroadcastMessage(*msg)
+	return nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"DDNETONE/db"
+	"DDNETONE/model"
+)
+
+// Cross-instance fan-out — each instance NOTIFYs the IDs it changed on
+// notifyChannel and LISTENs for the other instances' notifications, then
+// feeds them into its own broadcaster so local SSE clients see every write.
+//
+// 事件版本為各實例獨立計數，事件 ID 帶上 instanceID 作為 epoch；
+// 重連到不同實例時 epoch 不符，會改收完整快照而不是重播。
+
+const notifyChannel = "ddnetone_events"
+
+// instanceID 用來忽略自己送出的 NOTIFY
+var instanceID = newInstanceID()
+
+func newInstanceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// changeNotification 為 NOTIFY payload（上限 8000 bytes，因此只帶 ID）
+type changeNotification struct {
+	Origin     string          `json:"origin"`
+	RecordIDs  []uint          `json:"record_ids,omitempty"`
+	MessageIDs []uint          `json:"message_ids,omitempty"`
+	Deleted    []deletedRecord `json:"deleted,omitempty"`
+	Aggregates bool            `json:"aggregates,omitempty"`
+	Presence   bool            `json:"presence,omitempty"`
+}
+
+// deletedRecord 帶上 difficulty 與 runner，讓其他實例能以相同 topics 送出 record.deleted
+type deletedRecord struct {
+	ID         uint   `json:"id"`
+	Difficulty string `json:"difficulty"`
+	Runner     string `json:"runner,omitempty"`
+}
+
+// maxNotifyPayload 為單一 NOTIFY payload 的大小上限（PostgreSQL 預設 8000 bytes，留一點餘裕）
+const maxNotifyPayload = 7900
+
+// notifyPeers 將本機寫入的 ID 通知其他實例，對方收到後會重新計算並廣播；
+// 超過 maxNotifyPayload 時拆成多則送出
+func notifyPeers(change changeNotification) {
+	for _, payload := range splitNotification(change) {
+		if err := db.GetDB().Exec("SELECT pg_notify(?, ?)", notifyChannel, string(payload)).Error; err != nil {
+			log.Println("NOTIFY: failed to send:", err)
+		}
+	}
+}
+
+// splitNotification 將 ID 清單對半拆分直到每則 payload 都小於 maxNotifyPayload；
+// aggregates / presence 旗標每則都保留（對方重複計算只會多送一次相同的事件）
+func splitNotification(change changeNotification) [][]byte {
+	payload, err := json.Marshal(change)
+	if err != nil {
+		log.Println("NOTIFY: failed to marshal payload:", err)
+		return nil
+	}
+	items := len(change.RecordIDs) + len(change.MessageIDs) + len(change.Deleted)
+	if len(payload) < maxNotifyPayload || items <= 1 {
+		return [][]byte{payload}
+	}
+
+	// 前半數的項目依 record_ids、message_ids、deleted 的順序放進第一則
+	half := items / 2
+	r := min(half, len(change.RecordIDs))
+	m := min(half-r, len(change.MessageIDs))
+	d := half - r - m
+	first, second := change, change
+	first.RecordIDs, second.RecordIDs = change.RecordIDs[:r], change.RecordIDs[r:]
+	first.MessageIDs, second.MessageIDs = change.MessageIDs[:m], change.MessageIDs[m:]
+	first.Deleted, second.Deleted = change.Deleted[:d], change.Deleted[d:]
+	return append(splitNotification(first), splitNotification(second)...)
+}
+
+// StartNotifyListener LISTENs on a dedicated connection in the background and
+// reconnects with backoff if the connection drops.
+func StartNotifyListener() {
+	go func() {
+		backoff := time.Second
+		for {
+			err := listenForPeers(context.Background())
+			log.Printf("LISTEN: connection lost (%v), retrying in %s", err, backoff)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, 30*time.Second)
+		}
+	}()
+}
+
+func listenForPeers(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, db.DSN())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{notifyChannel}.Sanitize()); err != nil {
+		return err
+	}
+	log.Println("LISTEN: subscribed to", notifyChannel)
+
+	// 斷線期間可能漏掉通知，重新連上時先排一次廣播讓彙總對齊
+	sseBroadcaster.enqueue(pendingChange{aggregates: true, presence: true})
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var change changeNotification
+		if err := json.Unmarshal([]byte(n.Payload), &change); err != nil {
+			log.Println("LISTEN: ignoring malformed payload:", err)
+			continue
+		}
+		if change.Origin == instanceID {
+			continue
+		}
+		applyPeerChange(change)
+	}
+}
+
+// applyPeerChange 讀回其他實例修改的資料並交給本機 broadcaster（不再轉發 NOTIFY）
+func applyPeerChange(change changeNotification) {
+	database := db.GetDB()
+
+	// 重新讀取的記錄可能比本機已廣播的版本舊（讀取後本機又 commit 了新的寫入），
+	// enqueue 會以 MapRecord.Version 比對排行榜索引並略過舊版本
+	records := []model.MapRecord{}
+	if len(change.RecordIDs) > 0 {
+		if err := database.Where("id IN ?", change.RecordIDs).Find(&records).Error; err != nil {
+			log.Println("NOTIFY: failed to load peer records:", err)
+		}
+	}
+	messages := []model.Message{}
+	if len(change.MessageIDs) > 0 {
+		if err := database.Where("id IN ?", change.MessageIDs).Order("id asc").Find(&messages).Error; err != nil {
+			log.Println("NOTIFY: failed to load peer messages:", err)
+		}
+	}
+
+	deleted := make([]model.MapRecord, len(change.Deleted))
+	for i, d := range change.Deleted {
+		deleted[i] = model.MapRecord{ID: d.ID, Difficulty: d.Difficulty, Runner: d.Runner}
+	}
+
+	sseBroadcaster.enqueue(pendingChange{
+		records:    records,
+		deleted:    deleted,
+		messages:   messages,
+		aggregates: change.Aggregates,
+		presence:   change.Presence,
+	})
+}
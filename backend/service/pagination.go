@@ -0,0 +1,218 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Cursor pagination — list endpoints accept
+//
+//	limit=50           每頁筆數（1..200）
+//	sort=score         排序欄位（各 endpoint 不同）
+//	order=asc|desc     排序方向
+//	cursor=<opaque>    上一頁回傳的 next_cursor
+//	paginate=false     相容模式：回傳舊版的完整陣列（忽略 limit/cursor）
+//
+// 回傳 {"items": [...], "total": N, "limit": 50, "next_cursor": "..."}，
+// total 為套用篩選後（不含 cursor）的總筆數。
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// Page 為分頁回傳格式
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	Limit      int    `json:"limit"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// sortSpec 描述一個可排序欄位：SQL 運算式、取出排序值與還原 cursor 值的方式
+type sortSpec[T any] struct {
+	expr  string
+	key   func(T) string
+	parse func(string) (interface{}, error)
+}
+
+func intSort[T any](expr string, get func(T) int) sortSpec[T] {
+	return sortSpec[T]{
+		expr: expr,
+		key:  func(v T) string { return strconv.Itoa(get(v)) },
+		parse: func(s string) (interface{}, error) {
+			return strconv.Atoi(s)
+		},
+	}
+}
+
+func stringSort[T any](expr string, get func(T) string) sortSpec[T] {
+	return sortSpec[T]{
+		expr:  expr,
+		key:   get,
+		parse: func(s string) (interface{}, error) { return s, nil },
+	}
+}
+
+// timeSort 的 get 回傳零值代表 NULL，expr 需以相同的零值 COALESCE
+func timeSort[T any](expr string, get func(T) time.Time) sortSpec[T] {
+	return sortSpec[T]{
+		expr: expr,
+		key:  func(v T) string { return get(v).UTC().Format(time.RFC3339Nano) },
+		parse: func(s string) (interface{}, error) {
+			return time.Parse(time.RFC3339Nano, s)
+		},
+	}
+}
+
+// pageCursor 綁定排序欄位與方向，換排序時舊 cursor 會被拒絕
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    uint   `json:"id"`
+}
+
+func (pc pageCursor) encode() string {
+	raw, _ := json.Marshal(pc)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var pc pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pc, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(raw, &pc); err != nil {
+		return pc, errors.New("invalid cursor")
+	}
+	return pc, nil
+}
+
+// pageRequest 為解析後的分頁參數
+type pageRequest struct {
+	legacy bool
+	limit  int
+	sort   string
+	desc   bool
+	cursor *pageCursor
+}
+
+// parsePage 解析分頁參數；specs 為允許的排序欄位
+func parsePage[T any](c *gin.Context, specs map[string]sortSpec[T], defaultSort string, defaultDesc bool) (pageRequest, error) {
+	req := pageRequest{limit: defaultPageLimit, sort: defaultSort, desc: defaultDesc}
+
+	if raw := c.Query("paginate"); raw != "" {
+		paginate, err := strconv.ParseBool(raw)
+		if err != nil {
+			return req, errors.New("paginate must be true or false")
+		}
+		req.legacy = !paginate
+	}
+
+	if raw := c.Query("sort"); raw != "" {
+		if _, ok := specs[raw]; !ok {
+			names := make([]string, 0, len(specs))
+			for name := range specs {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			return req, fmt.Errorf("invalid sort %q (allowed: %s)", raw, strings.Join(names, ", "))
+		}
+		req.sort = raw
+	}
+	switch strings.ToLower(c.Query("order")) {
+	case "":
+	case "asc":
+		req.desc = false
+	case "desc":
+		req.desc = true
+	default:
+		return req, errors.New("order must be asc or desc")
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return req, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+		req.limit = n
+	}
+
+	if raw := c.Query("cursor"); raw != "" && !req.legacy {
+		pc, err := decodeCursor(raw)
+		if err != nil {
+			return req, err
+		}
+		if pc.Sort != req.sort || pc.Desc != req.desc {
+			return req, errors.New("cursor does not match sort/order")
+		}
+		if _, err := specs[req.sort].parse(pc.Value); err != nil {
+			return req, errors.New("invalid cursor")
+		}
+		req.cursor = &pc
+	}
+	return req, nil
+}
+
+// paginate 依 req 排序並取出一頁（以 id 作為同值時的次要排序）。
+// query 需已設定 Model 與篩選條件；legacy 時回傳全部資料、NextCursor 為空。
+func paginate[T any](query *gorm.DB, req pageRequest, specs map[string]sortSpec[T], id func(T) uint) (Page[T], error) {
+	spec := specs[req.sort]
+	dir := "ASC"
+	cmp := ">"
+	if req.desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	base := query.Session(&gorm.Session{})
+	page := Page[T]{Items: []T{}, Limit: req.limit}
+
+	if err := base.Count(&page.Total).Error; err != nil {
+		return page, err
+	}
+
+	q := base.Order(fmt.Sprintf("%s %s, id %s", spec.expr, dir, dir))
+	if req.legacy {
+		err := q.Find(&page.Items).Error
+		page.Limit = len(page.Items)
+		return page, err
+	}
+
+	if req.cursor != nil {
+		// parsePage 已驗證過 cursor 值
+		value, _ := spec.parse(req.cursor.Value)
+		q = q.Where(fmt.Sprintf("((%s %s ?) OR (%s = ? AND id %s ?))", spec.expr, cmp, spec.expr, cmp),
+			value, value, req.cursor.ID)
+	}
+
+	if err := q.Limit(req.limit + 1).Find(&page.Items).Error; err != nil {
+		return page, err
+	}
+	if len(page.Items) > req.limit {
+		page.Items = page.Items[:req.limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = pageCursor{Sort: req.sort, Desc: req.desc, Value: spec.key(last), ID: id(last)}.encode()
+	}
+	return page, nil
+}
+
+// respondPage 在相容模式下回傳舊版陣列，否則回傳 Page
+func respondPage[T any](c *gin.Context, req pageRequest, page Page[T]) {
+	if req.legacy {
+		c.JSON(http.StatusOK, page.Items)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
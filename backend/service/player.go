@@ -1,60 +1,227 @@
 package service
 
 import (
+	"math"
 	"net/http"
 	"sort"
+	"strconv"
+	"time"
 
 	"DDNETONE/db"
 	"DDNETONE/model"
-	"DDNETONE/utils"
 	"github.com/gin-gonic/gin"
 )
 
-// buildLeaderboard computes the leaderboard from DB (shared by API and SSE).
-func buildLeaderboard() []model.PlayerStats {
-	var records []model.MapRecord
-	if err := db.GetDB().Where("status = 2 AND score > 0").Find(&records).Error; err != nil {
-		return []model.PlayerStats{}
+// playerActivity 為單一玩家從 map_records 彙整出的統計
+type playerActivity struct {
+	score float64
+	count int
+	days  map[time.Time]struct{} // 完成日期（loc 時區的日曆日，以 UTC 午夜表示）
+}
+
+// collectPlayerActivity aggregates the leaderboard index by player (shared by leaderboard and streaks).
+func collectPlayerActivity(loc *time.Location) (map[string]*playerActivity, error) {
+	activity, _, _, err := leaderboardCache.activity(loc)
+	return activity, err
+}
+
+// civilDay 將時間轉為 loc 時區的日曆日（UTC 午夜），方便以天數相減
+func civilDay(t time.Time, loc *time.Location) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// streakInfo 計算目前連續天數、最長連續天數與最後活躍日。
+// 目前連續天數在今天或昨天有完成時才算延續。
+func streakInfo(days map[time.Time]struct{}, today time.Time) (current, longest int, last time.Time) {
+	if len(days) == 0 {
+		return 0, 0, time.Time{}
+	}
+
+	sorted := make([]time.Time, 0, len(days))
+	for d := range days {
+		sorted = append(sorted, d)
 	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
 
-	scoreMap := make(map[string]float64)
-	countMap := make(map[string]int)
-	for _, r := range records {
-		for _, name := range utils.ParseRunnerNames(r.Runner) {
-			scoreMap[name] += float64(r.Score)
-			countMap[name]++
+	run := 0
+	for i, d := range sorted {
+		if i > 0 && d.Sub(sorted[i-1]) == 24*time.Hour {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
 		}
 	}
 
-	var players []model.Player
-	db.GetDB().Find(&players)
-	roleMap := make(map[string]string)
-	idMap := make(map[string]uint)
-	for _, p := range players {
-		roleMap[p.Name] = p.Role
-		idMap[p.Name] = p.ID
+	last = sorted[len(sorted)-1]
+	if gap := today.Sub(last); gap <= 24*time.Hour {
+		current = run
+	}
+	return current, longest, last
+}
+
+// leaderboardAt 回傳排行榜與最後修改時間（連續天數會隨日期改變，因此不早於 loc 的今天零時）
+func leaderboardAt(loc *time.Location) ([]model.PlayerStats, time.Time, error) {
+	activity, players, modified, err := leaderboardCache.activity(loc)
+	if err != nil {
+		return nil, time.Time{}, err
 	}
 
-	var result []model.PlayerStats
-	for name, score := range scoreMap {
-		result = append(result, model.PlayerStats{
-			ID:                idMap[name],
+	now := time.Now()
+	today := civilDay(now, loc)
+	result := []model.PlayerStats{}
+	for name, a := range activity {
+		current, longest, last := streakInfo(a.days, today)
+		stats := model.PlayerStats{
+			ID:                players[name].ID,
 			Name:              name,
-			Role:              roleMap[name],
-			ScoreContribution: score,
-			MapCount:          countMap[name],
-		})
+			Role:              players[name].Role,
+			ScoreContribution: a.score,
+			MapCount:          a.count,
+			CurrentStreak:     current,
+			LongestStreak:     longest,
+		}
+		if !last.IsZero() {
+			stats.LastActive = last.Format("2006-01-02")
+		}
+		result = append(result, stats)
 	}
 
 	sort.Slice(result, func(i, j int) bool {
-		return result[i].ScoreContribution > result[j].ScoreContribution
+		if result[i].ScoreContribution != result[j].ScoreContribution {
+			return result[i].ScoreContribution > result[j].ScoreContribution
+		}
+		return result[i].Name < result[j].Name
 	})
 
-	return result
+	y, m, d := now.In(loc).Date()
+	if midnight := time.Date(y, m, d, 0, 0, 0, 0, loc); midnight.After(modified) {
+		modified = midnight
+	}
+	return result, modified, nil
 }
 
+// GetLeaderboard 支援 If-None-Match / If-Modified-Since 條件式請求
 func GetLeaderboard(c *gin.Context) {
-	c.JSON(http.StatusOK, buildLeaderboard())
+	loc, err := resolveTimezone(c)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+
+	stats, modified, err := leaderboardAt(loc)
+	if err != nil {
+		respondError(c, internalError("failed to load leaderboard", err))
+		return
+	}
+	etag, err := leaderboardETag(stats)
+	if err != nil {
+		respondError(c, internalError("failed to load leaderboard", err))
+		return
+	}
+
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-cache")
+	if notModified(c, etag, modified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// buildStreaks 回傳所有玩家（含尚未完成任何地圖的已登錄玩家）的連續紀錄
+func buildStreaks(loc *time.Location) ([]model.PlayerStreak, error) {
+	activity, err := collectPlayerActivity(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	if err := db.GetDB().Model(&model.Player{}).Distinct("name").Pluck("name", &names).Error; err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if _, ok := activity[name]; !ok {
+			activity[name] = &playerActivity{days: make(map[time.Time]struct{})}
+		}
+	}
+
+	today := civilDay(time.Now(), loc)
+	result := make([]model.PlayerStreak, 0, len(activity))
+	for name, a := range activity {
+		current, longest, last := streakInfo(a.days, today)
+		streak := model.PlayerStreak{
+			Name:          name,
+			CurrentStreak: current,
+			LongestStreak: longest,
+			DaysInactive:  -1,
+		}
+		if !last.IsZero() {
+			streak.LastActive = last.Format("2006-01-02")
+			streak.DaysInactive = int(today.Sub(last).Hours() / 24)
+		}
+		result = append(result, streak)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CurrentStreak != result[j].CurrentStreak {
+			return result[i].CurrentStreak > result[j].CurrentStreak
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// GetStreaks 回傳玩家連續完成天數
+// Query: tz, inactive_days=N 時只回傳 N 天以上未完成地圖（或從未完成）的玩家
+func GetStreaks(c *gin.Context) {
+	loc, err := resolveTimezone(c)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+
+	inactiveDays := -1
+	if raw := c.Query("inactive_days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			respondError(c, badRequest("inactive_days must be a non-negative integer"))
+			return
+		}
+		inactiveDays = n
+	}
+
+	streaks, err := buildStreaks(loc)
+	if err != nil {
+		respondError(c, internalError("failed to compute streaks", err))
+		return
+	}
+
+	if inactiveDays >= 0 {
+		inactive := []model.PlayerStreak{}
+		for _, s := range streaks {
+			if s.DaysInactive < 0 || s.DaysInactive >= inactiveDays {
+				inactive = append(inactive, s)
+			}
+		}
+		// 從未完成者排最前，其餘依未活躍天數由多到少
+		idle := func(s model.PlayerStreak) int {
+			if s.DaysInactive < 0 {
+				return math.MaxInt
+			}
+			return s.DaysInactive
+		}
+		sort.SliceStable(inactive, func(i, j int) bool {
+			return idle(inactive[i]) > idle(inactive[j])
+		})
+		streaks = inactive
+	}
+
+	c.JSON(http.StatusOK, streaks)
 }
 
 func GetPlayerOptions(c *gin.Context) {
@@ -67,7 +234,7 @@ func GetPlayerOptions(c *gin.Context) {
 		Pluck("name", &names).Error
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "無法獲取玩家列表"})
+		respondError(c, internalError("failed to load players", err))
 		return
 	}
 
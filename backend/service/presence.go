@@ -0,0 +1,212 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"DDNETONE/db"
+	"DDNETONE/model"
+	"DDNETONE/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// presenceTTL 為未收到 heartbeat 時 presence 保留的時間
+	presenceTTL = 90 * time.Second
+	// presenceSweepInterval 為清除過期 presence 的頻率
+	presenceSweepInterval = 15 * time.Second
+
+	eventPresenceChanged = "presence.changed"
+)
+
+type PresenceChangedEvent struct {
+	Version  uint64           `json:"version"`
+	Presence []model.Presence `json:"presence"`
+}
+
+// SetPresenceRequest 標記玩家正在玩某張地圖
+type SetPresenceRequest struct {
+	Player     string   `json:"player" binding:"required,max=32"`
+	MapName    string   `json:"map_name" binding:"required,max=128"`
+	Difficulty string   `json:"difficulty" binding:"required,difficulty"`
+	With       []string `json:"with" binding:"max=8,dive,max=32"`
+}
+
+// SetPresenceResponse 同時回傳同一張地圖上的其他玩家，避免兩組人重複挑戰
+type SetPresenceResponse struct {
+	Presence model.Presence   `json:"presence"`
+	SameMap  []model.Presence `json:"same_map"`
+}
+
+var errPresenceNotFound = errors.New("no active presence for player")
+
+// activePresence 回傳尚未過期的 presence（依地圖、玩家排序）
+func activePresence() ([]model.Presence, error) {
+	presence := []model.Presence{}
+	err := db.GetDB().Where("expires_at > ?", time.Now()).
+		Order("difficulty asc, map_name asc, player asc").
+		Find(&presence).Error
+	return presence, err
+}
+
+// buildPresenceEvent encodes the current presence list. Caller holds sseStateMu.
+func buildPresenceEvent() (sseEvent, error) {
+	presence, err := activePresence()
+	if err != nil {
+		return sseEvent{}, err
+	}
+	topics := []string{topicPresence}
+	for _, p := range presence {
+		topics = append(topics, playerTopic(p.Player))
+	}
+	return newEvent(eventPresenceChanged, topics, func(v uint64) interface{} {
+		return PresenceChangedEvent{Version: v, Presence: presence}
+	})
+}
+
+// setPresence 建立或續約玩家的 presence；換地圖時重設 StartedAt（REST 與 WebSocket 共用）
+func setPresence(req SetPresenceRequest) (SetPresenceResponse, error) {
+	database := db.GetDB()
+	now := time.Now()
+
+	var partners []string
+	for _, name := range req.With {
+		partners = append(partners, utils.ParseRunnerNames(name)...)
+	}
+
+	var presence model.Presence
+	err := database.Where("player = ?", req.Player).First(&presence).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return SetPresenceResponse{}, err
+	}
+	if err != nil || presence.ExpiresAt.Before(now) ||
+		presence.MapName != req.MapName || presence.Difficulty != req.Difficulty {
+		presence.StartedAt = now
+	}
+	presence.Player = req.Player
+	presence.MapName = req.MapName
+	presence.Difficulty = req.Difficulty
+	presence.Partners = strings.Join(partners, ", ")
+	presence.ExpiresAt = now.Add(presenceTTL)
+
+	if presence.ID != 0 {
+		err = database.Save(&presence).Error
+	} else {
+		// 同一玩家同時送出時以後到者為準
+		err = database.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "player"}},
+			DoUpdates: clause.AssignmentColumns([]string{"map_name", "difficulty", "partners", "started_at", "expires_at"}),
+		}).Create(&presence).Error
+	}
+	if err != nil {
+		return SetPresenceResponse{}, err
+	}
+
+	// 同一張地圖上、不在本組內的其他玩家
+	group := append([]string{req.Player}, partners...)
+	sameMap := []model.Presence{}
+	err = database.Where("map_name = ? AND difficulty = ? AND expires_at > ? AND player NOT IN ?",
+		req.MapName, req.Difficulty, now, group).
+		Order("player asc").Find(&sameMap).Error
+	if err != nil {
+		return SetPresenceResponse{}, err
+	}
+
+	BroadcastPresence()
+	return SetPresenceResponse{Presence: presence, SameMap: sameMap}, nil
+}
+
+// renewPresence 延長玩家 presence 的 TTL（heartbeat）
+func renewPresence(player string) (model.Presence, error) {
+	database := db.GetDB()
+	var presence model.Presence
+	err := database.Where("player = ? AND expires_at > ?", player, time.Now()).First(&presence).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return presence, errPresenceNotFound
+	}
+	if err != nil {
+		return presence, err
+	}
+
+	presence.ExpiresAt = time.Now().Add(presenceTTL)
+	if err := database.Model(&presence).Update("expires_at", presence.ExpiresAt).Error; err != nil {
+		return presence, err
+	}
+	return presence, nil
+}
+
+// GetPresence 回傳目前正在玩的玩家
+func GetPresence(c *gin.Context) {
+	presence, err := activePresence()
+	if err != nil {
+		respondError(c, internalError("failed to load presence", err))
+		return
+	}
+	c.JSON(http.StatusOK, presence)
+}
+
+// SetPresence 標記「正在玩地圖 X（與 Y 一起）」，重複呼叫即續約
+func SetPresence(c *gin.Context) {
+	var req SetPresenceRequest
+	if err := bindJSON(c, &req); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	resp, err := setPresence(req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// PresenceHeartbeat 續約玩家的 presence
+func PresenceHeartbeat(c *gin.Context) {
+	presence, err := renewPresence(c.Param("player"))
+	if errors.Is(err, errPresenceNotFound) {
+		respondError(c, notFound(err.Error()))
+		return
+	}
+	if err != nil {
+		respondError(c, internalError("failed to renew presence", err))
+		return
+	}
+	c.JSON(http.StatusOK, presence)
+}
+
+// ClearPresence 玩家停止遊玩
+func ClearPresence(c *gin.Context) {
+	result := db.GetDB().Where("player = ?", c.Param("player")).Delete(&model.Presence{})
+	if result.Error != nil {
+		respondError(c, internalError("failed to clear presence", result.Error))
+		return
+	}
+	if result.RowsAffected > 0 {
+		BroadcastPresence()
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// StartPresenceSweeper 定期刪除過期的 presence 並廣播
+func StartPresenceSweeper() {
+	go func() {
+		ticker := time.NewTicker(presenceSweepInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			result := db.GetDB().Where("expires_at <= ?", time.Now()).Delete(&model.Presence{})
+			if result.Error != nil {
+				log.Println("Presence: failed to sweep:", result.Error)
+				continue
+			}
+			if result.RowsAffected > 0 {
+				BroadcastPresence()
+			}
+		}
+	}()
+}
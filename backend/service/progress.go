@@ -0,0 +1,88 @@
+package service
+
+import (
+	"net/http"
+	"sort"
+
+	"DDNETONE/db"
+	"DDNETONE/model"
+	"github.com/gin-gonic/gin"
+)
+
+// StarProgress 為單一星數的完成狀況
+type StarProgress struct {
+	Stars     int `json:"stars"`
+	Completed int `json:"completed"`
+	Total     int `json:"total"`
+}
+
+// DifficultyProgress 為單一難度的完成狀況
+type DifficultyProgress struct {
+	Difficulty      string         `json:"difficulty"`
+	CompletedMaps   int            `json:"completed_maps"`
+	TotalMaps       int            `json:"total_maps"`
+	PointsEarned    int            `json:"points_earned"`
+	PointsAvailable int            `json:"points_available"`
+	Stars           []StarProgress `json:"stars"`
+}
+
+// buildProgress computes per-difficulty progress (shared by API and SSE).
+// Retired maps are left out, same as the summary.
+func buildProgress() ([]DifficultyProgress, error) {
+	type row struct {
+		Difficulty      string
+		Stars           int
+		CompletedMaps   int
+		TotalMaps       int
+		PointsEarned    int
+		PointsAvailable int
+	}
+
+	var rows []row
+	err := db.GetDB().Model(&model.MapRecord{}).
+		Select(`difficulty, stars,
+			COUNT(*) FILTER (WHERE status IN ?) AS completed_maps,
+			COUNT(*) AS total_maps,
+			COALESCE(SUM(points) FILTER (WHERE status IN ?), 0) AS points_earned,
+			COALESCE(SUM(points), 0) AS points_available`, model.CompletedStatuses, model.CompletedStatuses).
+		Where("NOT retired").
+		Group("difficulty, stars").
+		Order("difficulty asc, stars asc").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byDifficulty := make(map[string]*DifficultyProgress)
+	for _, r := range rows {
+		p, ok := byDifficulty[r.Difficulty]
+		if !ok {
+			p = &DifficultyProgress{Difficulty: r.Difficulty, Stars: []StarProgress{}}
+			byDifficulty[r.Difficulty] = p
+		}
+		p.CompletedMaps += r.CompletedMaps
+		p.TotalMaps += r.TotalMaps
+		p.PointsEarned += r.PointsEarned
+		p.PointsAvailable += r.PointsAvailable
+		p.Stars = append(p.Stars, StarProgress{Stars: r.Stars, Completed: r.CompletedMaps, Total: r.TotalMaps})
+	}
+
+	result := make([]DifficultyProgress, 0, len(byDifficulty))
+	for _, p := range byDifficulty {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Difficulty < result[j].Difficulty
+	})
+	return result, nil
+}
+
+// GetProgress 回傳各難度的完成數、分數與星數分布
+func GetProgress(c *gin.Context) {
+	progress, err := buildProgress()
+	if err != nil {
+		respondError(c, internalError("failed to compute progress", err))
+		return
+	}
+	c.JSON(http.StatusOK, progress)
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"DDNETONE/db"
+	"DDNETONE/model"
+	"DDNETONE/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Map recommendations — 從未完成且未退役的地圖（同 GetMapOptions）中挑選下一張，
+// 權重來自三個部分：
+//
+//	affinity    指定玩家（players=a,b；未指定時為全隊）過去完成的難度與星數分布
+//	efficiency  每顆星可得的分數（points / stars），相對於候選中的最高值
+//	claim       已由這組玩家預約的地圖加權；被其他組預約中的地圖排除
+//
+// Query: players, count (預設 5), mode=random|top, seed，以及 filter.go 的
+// difficulty、stars_min、stars_max、has_dummy 篩選。
+
+const (
+	defaultRecommendCount = 5
+	maxRecommendCount     = 50
+
+	recommendBaseWeight       = 0.2
+	recommendAffinityWeight   = 0.4
+	recommendEfficiencyWeight = 0.4
+	recommendClaimBonus       = 0.3
+)
+
+// MapRecommendation 為推薦結果，Reasons 說明權重來源
+type MapRecommendation struct {
+	Map     model.MapRecord `json:"map"`
+	Weight  float64         `json:"weight"`
+	Reasons []string        `json:"reasons"`
+}
+
+// clearHistory 為一組玩家的完成紀錄分布
+type clearHistory struct {
+	total      int
+	byDiff     map[string]int
+	starSum    map[string]int
+	maxDiffCnt int
+}
+
+func (h clearHistory) avgStars(difficulty string) (float64, bool) {
+	n := h.byDiff[difficulty]
+	if n == 0 {
+		return 0, false
+	}
+	return float64(h.starSum[difficulty]) / float64(n), true
+}
+
+// loadClearHistory 彙整 players 參與的已完成記錄；players 為空時統計全部
+func loadClearHistory(players []string) (clearHistory, error) {
+	h := clearHistory{byDiff: make(map[string]int), starSum: make(map[string]int)}
+
+	var records []model.MapRecord
+	if err := db.GetDB().Where("status IN ?", model.CompletedStatuses).Find(&records).Error; err != nil {
+		return h, err
+	}
+
+	wanted := make(map[string]bool, len(players))
+	for _, p := range players {
+		wanted[p] = true
+	}
+	for _, r := range records {
+		if len(wanted) > 0 {
+			match := false
+			for _, name := range utils.ParseRunnerNames(r.Runner) {
+				if wanted[name] {
+					match = true
+					break
+				}
+			}
+			if !match {
+				continue
+			}
+		}
+		h.total++
+		h.byDiff[r.Difficulty]++
+		h.starSum[r.Difficulty] += r.Stars
+		h.maxDiffCnt = max(h.maxDiffCnt, h.byDiff[r.Difficulty])
+	}
+	return h, nil
+}
+
+// pointsPerStar 為 efficiency 的原始值（0 星視為 1 星）
+func pointsPerStar(r model.MapRecord) float64 {
+	return float64(r.Points) / float64(max(r.Stars, 1))
+}
+
+// RecommendMaps 推薦下一張要玩的地圖並附上理由
+func RecommendMaps(c *gin.Context) {
+	count := defaultRecommendCount
+	if raw := c.Query("count"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxRecommendCount {
+			respondError(c, badRequest("count must be between 1 and 50"))
+			return
+		}
+		count = n
+	}
+
+	mode := c.DefaultQuery("mode", "random")
+	if mode != "random" && mode != "top" {
+		respondError(c, badRequest("mode must be random or top"))
+		return
+	}
+
+	seed := uint64(time.Now().UnixNano())
+	if raw := c.Query("seed"); raw != "" {
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			respondError(c, badRequest("seed must be a non-negative integer"))
+			return
+		}
+		seed = n
+	}
+
+	group := utils.ParseRunnerNames(c.Query("players"))
+
+	query, err := applyRecordFilters(c, db.GetDB().Model(&model.MapRecord{}))
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+	var candidates []model.MapRecord
+	if err := query.Where("status NOT IN ? AND NOT retired", model.CompletedStatuses).Find(&candidates).Error; err != nil {
+		respondError(c, internalError("failed to load maps", err))
+		return
+	}
+
+	history, err := loadClearHistory(group)
+	if err != nil {
+		respondError(c, internalError("failed to load completion history", err))
+		return
+	}
+
+	bestEfficiency := 0.0
+	for _, m := range candidates {
+		bestEfficiency = math.Max(bestEfficiency, pointsPerStar(m))
+	}
+
+	now := time.Now()
+	recs := []MapRecommendation{}
+	for _, m := range candidates {
+		rec := MapRecommendation{Map: m, Weight: recommendBaseWeight, Reasons: []string{}}
+
+		if claimActive(m, now) {
+			if len(group) == 0 || !sharesRunner(m.Runner, c.Query("players")) {
+				continue
+			}
+			rec.Weight += recommendClaimBonus
+			rec.Reasons = append(rec.Reasons, "already claimed by "+m.Runner)
+		}
+
+		// affinity：這組人常玩的難度，以及接近平常星數的地圖
+		if history.total > 0 {
+			diffShare := float64(history.byDiff[m.Difficulty]) / float64(history.maxDiffCnt)
+			affinity := 0.5 * diffShare
+			if avg, ok := history.avgStars(m.Difficulty); ok {
+				closeness := 1 / (1 + math.Abs(float64(m.Stars)-avg))
+				affinity += 0.5 * closeness
+				rec.Reasons = append(rec.Reasons,
+					fmt.Sprintf("%s: %d of %d past clears", m.Difficulty, history.byDiff[m.Difficulty], history.total),
+					fmt.Sprintf("%d★ vs. usual %.1f★ in %s", m.Stars, avg, m.Difficulty))
+			} else {
+				rec.Reasons = append(rec.Reasons, fmt.Sprintf("%s: no past clears yet", m.Difficulty))
+			}
+			rec.Weight += recommendAffinityWeight * affinity
+		}
+
+		// efficiency：每顆星的分數
+		if bestEfficiency > 0 {
+			efficiency := pointsPerStar(m) / bestEfficiency
+			rec.Weight += recommendEfficiencyWeight * efficiency
+			rec.Reasons = append(rec.Reasons, fmt.Sprintf("%.1f points per star (%.0f%% of best)", pointsPerStar(m), efficiency*100))
+		}
+
+		rec.Weight = math.Round(rec.Weight*1000) / 1000
+		recs = append(recs, rec)
+	}
+
+	if history.total == 0 {
+		for i := range recs {
+			recs[i].Reasons = append(recs[i].Reasons, "no completion history for these players")
+		}
+	}
+
+	if mode == "random" {
+		// 加權抽樣不放回（Efraimidis–Spirakis）：key = u^(1/w)，取 key 最大的 count 筆
+		rng := rand.New(rand.NewPCG(seed, seed))
+		keys := make([]float64, len(recs))
+		for i, r := range recs {
+			keys[i] = math.Pow(rng.Float64(), 1/r.Weight)
+		}
+		idx := make([]int, len(recs))
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.Slice(idx, func(a, b int) bool { return keys[idx[a]] > keys[idx[b]] })
+		picked := make([]MapRecommendation, 0, min(count, len(recs)))
+		for _, i := range idx[:min(count, len(recs))] {
+			picked = append(picked, recs[i])
+		}
+		recs = picked
+	} else {
+		sort.SliceStable(recs, func(i, j int) bool {
+			if recs[i].Weight != recs[j].Weight {
+				return recs[i].Weight > recs[j].Weight
+			}
+			return recs[i].Map.MapName < recs[j].Map.MapName
+		})
+		recs = recs[:min(count, len(recs))]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mode": mode, "seed": strconv.FormatUint(seed, 10), "recommendations": recs})
+}
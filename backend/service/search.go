@@ -0,0 +1,191 @@
+package service
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"DDNETONE/db"
+	"DDNETONE/model"
+	"DDNETONE/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Map search — 比對前先正規化（去除變音符號、轉小寫、只保留字母與數字），
+// 因此 "naufrage4" 與 "Naufrage 4"、"epee" 與 "Épée" 視為相同。
+// 完全相同 > 前綴 > 包含；都不符合時以 trigram 相似度容忍錯字。
+// 候選記錄先在 SQL 以查詢的 trigram 篩選（見 searchPatterns），只對候選計算分數。
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	// searchThreshold 為 trigram 相似度下限（與 pg_trgm 預設相同）
+	searchThreshold = 0.3
+)
+
+// searchFields 為可搜尋的欄位與權重（地圖名稱最重要）
+var searchFields = []struct {
+	name   string
+	weight float64
+	values func(model.MapRecord) []string
+}{
+	{"map_name", 1.0, func(r model.MapRecord) []string { return []string{r.MapName} }},
+	{"mapper", 0.8, func(r model.MapRecord) []string { return utils.ParseRunnerNames(r.Mapper) }},
+	{"runner", 0.7, func(r model.MapRecord) []string { return utils.ParseRunnerNames(r.Runner) }},
+	{"note", 0.5, func(r model.MapRecord) []string { return append([]string{r.Note}, strings.Fields(r.Note)...) }},
+}
+
+// MapSearchResult 為搜尋結果，Relevance 介於 0 與 1
+type MapSearchResult struct {
+	model.MapRecord
+	Relevance float64 `json:"relevance"`
+	MatchedOn string  `json:"matched_on"`
+}
+
+var searchFolder = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// normalizeSearch 去除變音符號並只保留小寫字母與數字
+func normalizeSearch(s string) string {
+	folded, _, err := transform.String(searchFolder, s)
+	if err != nil {
+		folded = s
+	}
+	var b strings.Builder
+	for _, r := range strings.ToLower(folded) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// trigrams 回傳字串（前後補空白）的 trigram 集合
+func trigrams(s string) map[string]struct{} {
+	padded := []rune("  " + s + " ")
+	set := make(map[string]struct{}, len(padded))
+	for i := 0; i+3 <= len(padded); i++ {
+		set[string(padded[i:i+3])] = struct{}{}
+	}
+	return set
+}
+
+// similarity 為兩個 trigram 集合的 Jaccard 相似度
+func similarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for g := range a {
+		if _, ok := b[g]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// searchPatterns 回傳預先篩選用的 LIKE 樣式：符合包含比對的值必定含有查詢本身，
+// 錯字比對則幾乎都與查詢共有內部的 trigram，因此含有查詢的任一個 trigram 即為候選
+// （只共用開頭 / 結尾補白 trigram 的極短值會被略過）。太短的查詢不做錯字比對，直接以查詢本身篩選。
+func searchPatterns(query string) []string {
+	runes := []rune(query)
+	if len(runes) < 3 {
+		return []string{"%" + query + "%"}
+	}
+	seen := make(map[string]bool)
+	var patterns []string
+	for i := 0; i+3 <= len(runes); i++ {
+		if g := string(runes[i : i+3]); !seen[g] {
+			seen[g] = true
+			patterns = append(patterns, "%"+g+"%")
+		}
+	}
+	return patterns
+}
+
+// matchScore 比對已正規化的查詢與欄位值
+func matchScore(query string, queryGrams map[string]struct{}, value string) float64 {
+	v := normalizeSearch(value)
+	switch {
+	case v == "":
+		return 0
+	case v == query:
+		return 1
+	case strings.HasPrefix(v, query):
+		return 0.9
+	case strings.Contains(v, query):
+		return 0.8
+	case len([]rune(query)) < 3:
+		// 太短無法容錯比對
+		return 0
+	}
+	if sim := similarity(queryGrams, trigrams(v)); sim >= searchThreshold {
+		// 錯字比對的分數永遠低於包含
+		return sim * 0.75
+	}
+	return 0
+}
+
+// SearchMaps 模糊搜尋地圖名稱、作者、runner 與備註
+// Query: q, limit (預設 20)，以及 filter.go 的篩選參數（difficulty、status…）
+func SearchMaps(c *gin.Context) {
+	query := normalizeSearch(c.Query("q"))
+	if query == "" {
+		respondError(c, badRequest("q must contain at least one letter or digit"))
+		return
+	}
+
+	limit := defaultSearchLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			respondError(c, badRequest("limit must be between 1 and 100"))
+			return
+		}
+		limit = n
+	}
+
+	q, err := applyRecordFilters(c, db.GetDB().Model(&model.MapRecord{}))
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+	var records []model.MapRecord
+	if err := q.Where(db.MapSearchDocument+" LIKE ANY (ARRAY[?])", searchPatterns(query)).Find(&records).Error; err != nil {
+		respondError(c, internalError("failed to search maps", err))
+		return
+	}
+
+	queryGrams := trigrams(query)
+	results := []MapSearchResult{}
+	for _, r := range records {
+		best := MapSearchResult{MapRecord: r}
+		for _, field := range searchFields {
+			for _, value := range field.values(r) {
+				if score := matchScore(query, queryGrams, value) * field.weight; score > best.Relevance {
+					best.Relevance = score
+					best.MatchedOn = field.name
+				}
+			}
+		}
+		if best.Relevance > 0 {
+			results = append(results, best)
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Relevance != results[j].Relevance {
+			return results[i].Relevance > results[j].Relevance
+		}
+		return results[i].MapName < results[j].MapName
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	c.JSON(http.StatusOK, results)
+}
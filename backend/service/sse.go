@@ -1,11 +1,15 @@
 package service
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
+	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"DDNETONE/db"
@@ -16,41 +20,247 @@ import (
 // SSE Hub — manages all connected clients
 
 type sseClient struct {
-	ch chan []byte
+	ch     chan sseEvent
+	topics map[string]bool // nil = 訂閱全部，見 sse_topic.go
+
+	// 緩衝滿時不再逐筆丟棄：標記 stalledSince 並透過 resync 通知寫入端改送一次完整快照，
+	// 期間的事件直接合併掉；停滯超過 sseStallTimeout 則關閉 kick 斷線
+	resync       chan struct{}
+	kick         chan struct{}
+	kickOnce     sync.Once
+	stalledSince atomic.Int64 // unix nano，0 = 正常
+}
+
+func newSSEClient(topics map[string]bool) *sseClient {
+	return &sseClient{
+		ch:     make(chan sseEvent, 32),
+		topics: topics,
+		resync: make(chan struct{}, 1),
+		kick:   make(chan struct{}),
+	}
+}
+
+// deliver queues e for the client without blocking the broadcaster.
+func (c *sseClient) deliver(e sseEvent) {
+	if since := c.stalledSince.Load(); since != 0 {
+		// 已在等待重新同步，快照會涵蓋這筆事件
+		sseStats.coalesced.Add(1)
+		if time.Since(time.Unix(0, since)) > sseStallTimeout {
+			c.disconnect()
+		}
+		return
+	}
+
+	select {
+	case c.ch <- e:
+	default:
+		sseStats.dropped.Add(1)
+		c.stalledSince.Store(time.Now().UnixNano())
+		select {
+		case c.resync <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (c *sseClient) disconnect() {
+	c.kickOnce.Do(func() {
+		sseStats.disconnected.Add(1)
+		close(c.kick)
+	})
+}
+
+// sseStats 為慢速客戶端處理的累計計數
+var sseStats struct {
+	dropped      atomic.Uint64 // 緩衝已滿而未送入的事件
+	coalesced    atomic.Uint64 // 等待重新同步期間被快照取代的事件
+	resyncs      atomic.Uint64 // 補送的完整快照
+	disconnected atomic.Uint64 // 停滯過久被中斷的連線
 }
 
 var (
 	sseClients   = make(map[*sseClient]struct{})
 	sseMu        sync.RWMutex
 	sseHeartbeat = 25 * time.Second
+
+	// sseStallTimeout 為客戶端可停滯（無法消化事件或寫入阻塞）的最長時間
+	sseStallTimeout = 60 * time.Second
+
+	// sseState 保存上次廣播的內容，用來計算差異；sseStateMu 同時保證事件版本依序遞增。
+	// 版本只在本實例內連續，對外的事件 ID 為 "<instanceID>-<version>"（見 formatEventID）。
+	sseState   = hubState{version: uint64(time.Now().UnixMilli())}
+	sseStateMu sync.Mutex
+
+	// sseHistory 保存最近的事件供 Last-Event-ID 重播（由 sseStateMu 保護）
+	sseHistory = newEventRing(256)
+)
+
+// SSE event names
+const (
+	eventSnapshot           = "update"
+	eventRecordUpdated      = "record.updated"
+	eventRecordDeleted      = "record.deleted"
+	eventSummaryChanged     = "summary.changed"
+	eventLeaderboardChanged = "leaderboard.changed"
+	eventGrowthAppended     = "growth.appended"
+	eventProgressChanged    = "progress.changed"
+	eventMessageCreated     = "message.created"
 )
 
+// hubState is the last state pushed to clients; deltas are computed against it.
+type hubState struct {
+	initialized  bool
+	version      uint64
+	summary      model.Summary
+	leaderboard  map[string]model.PlayerStats
+	progress     []byte
+	lastGrowthID uint
+}
+
+// sseEvent is an encoded event payload tagged with its event ID (= version) and
+// topics. Each transport (SSE / WebSocket) formats it on write.
+type sseEvent struct {
+	id      uint64
+	event   string
+	topics  []string
+	payload []byte
+}
+
+// eventRing is a bounded buffer of the most recent events, oldest first.
+type eventRing struct {
+	buf   []sseEvent
+	start int
+	size  int
+}
+
+func newEventRing(capacity int) *eventRing {
+	return &eventRing{buf: make([]sseEvent, capacity)}
+}
+
+func (r *eventRing) push(e sseEvent) {
+	if r.size < len(r.buf) {
+		r.buf[(r.start+r.size)%len(r.buf)] = e
+		r.size++
+		return
+	}
+	r.buf[r.start] = e
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+func (r *eventRing) reset() {
+	r.start, r.size = 0, 0
+}
+
+// since returns the events after lastID up to current. ok is false when the
+// buffer no longer reaches back to lastID+1 and the client needs a full snapshot.
+func (r *eventRing) since(lastID, current uint64) (events []sseEvent, ok bool) {
+	if lastID == current {
+		return nil, true
+	}
+	if lastID > current || r.size == 0 || r.buf[r.start].id > lastID+1 {
+		return nil, false
+	}
+	for i := 0; i < r.size; i++ {
+		e := r.buf[(r.start+i)%len(r.buf)]
+		if e.id > lastID {
+			events = append(events, e)
+		}
+	}
+	return events, true
+}
+
+// 每個事件都帶有 version，訂閱全部 topics 的客戶端發現版本不連續時應重新連線取得完整快照
+
+type RecordUpdatedEvent struct {
+	Version uint64            `json:"version"`
+	Records []model.MapRecord `json:"records"`
+}
+
+type RecordDeletedEvent struct {
+	Version uint64 `json:"version"`
+	IDs     []uint `json:"ids"`
+}
+
+type SummaryChangedEvent struct {
+	Version uint64        `json:"version"`
+	Summary model.Summary `json:"summary"`
+}
+
+type LeaderboardChangedEvent struct {
+	Version uint64              `json:"version"`
+	Changed []model.PlayerStats `json:"changed"`
+	Removed []string            `json:"removed"`
+}
+
+type GrowthAppendedEvent struct {
+	Version         uint64             `json:"version"`
+	Growth          []model.GrowthData `json:"growth"`
+	Milestones      []MilestoneResult  `json:"milestones"`
+	ScoreMilestones []MilestoneResult  `json:"score_milestones"`
+}
+
+type ProgressChangedEvent struct {
+	Version  uint64               `json:"version"`
+	Progress []DifficultyProgress `json:"progress"`
+}
+
+type MessageCreatedEvent struct {
+	Version uint64        `json:"version"`
+	Message model.Message `json:"message"`
+}
+
 // collectAllData gathers the same data that the frontend used to poll.
 func collectAllData() (map[string]interface{}, error) {
 	database := db.GetDB()
 
 	// summary
-	UpdateGlobalSummary()
-	var summary model.Summary
-	database.Last(&summary)
+	summary, err := latestSummary(database)
+	if err != nil {
+		return nil, err
+	}
 
 	// leaderboard (reuse logic from player.go)
-	leaderboard := buildLeaderboard()
+	leaderboard, _, err := leaderboardAt(DefaultLocation())
+	if err != nil {
+		return nil, err
+	}
 
 	// maps
 	var maps []model.MapRecord
-	database.Order("score desc").Find(&maps)
+	if err := database.Order("score desc").Find(&maps).Error; err != nil {
+		return nil, err
+	}
 
 	// growth (last 7 days)
-	sevenDaysAgo := time.Now().AddDate(0, 0, -7).Format(time.RFC3339)
-	var growth []model.GrowthData
-	database.Where("timestamp >= ?", sevenDaysAgo).Order("id asc").Find(&growth)
+	now := time.Now()
+	growth, err := buildGrowth(now.AddDate(0, 0, -7), now)
+	if err != nil {
+		return nil, err
+	}
 
 	// milestones
-	milestones := buildMilestones()
+	milestones, err := buildMilestones()
+	if err != nil {
+		return nil, err
+	}
 
 	// score milestones
-	scoreMilestones := buildScoreMilestones()
+	scoreMilestones, err := buildScoreMilestones()
+	if err != nil {
+		return nil, err
+	}
+
+	// per-difficulty progress
+	progress, err := buildProgress()
+	if err != nil {
+		return nil, err
+	}
+
+	// who is playing right now
+	presence, err := activePresence()
+	if err != nil {
+		return nil, err
+	}
 
 	return map[string]interface{}{
 		"summary":          summary,
@@ -59,50 +269,337 @@ func collectAllData() (map[string]interface{}, error) {
 		"growth":           growth,
 		"milestones":       milestones,
 		"score_milestones": scoreMilestones,
+		"progress":         progress,
+		"presence":         presence,
 	}, nil
 }
 
-// BroadcastUpdate collects fresh data and pushes it to every connected SSE client.
-func BroadcastUpdate() {
+// seedHubState initialises the diff baseline from a full snapshot. Caller holds sseStateMu.
+// 查詢失敗時不標記為已初始化，下一次快照會重試。
+func seedHubState(data map[string]interface{}) error {
+	progress, err := json.Marshal(data["progress"])
+	if err != nil {
+		return err
+	}
+	var lastGrowthID uint
+	if err := db.GetDB().Model(&model.GrowthData{}).Select("COALESCE(MAX(id), 0)").Scan(&lastGrowthID).Error; err != nil {
+		return err
+	}
+
+	sseState.summary = data["summary"].(model.Summary)
+	sseState.leaderboard = make(map[string]model.PlayerStats)
+	for _, p := range data["leaderboard"].([]model.PlayerStats) {
+		sseState.leaderboard[p.Name] = p
+	}
+	sseState.progress = progress
+	sseState.lastGrowthID = lastGrowthID
+	sseState.initialized = true
+	return nil
+}
+
+// newEvent encodes the next event and appends it to the replay buffer. Caller holds sseStateMu.
+func newEvent(event string, topics []string, build func(version uint64) interface{}) (sseEvent, error) {
+	payload, err := json.Marshal(build(sseState.version + 1))
+	if err != nil {
+		return sseEvent{}, err
+	}
+	sseState.version++
+	e := sseEvent{id: sseState.version, event: event, topics: topics, payload: payload}
+	sseHistory.push(e)
+	return e, nil
+}
+
+// buildDeltas recomputes the aggregates, diffs them against sseState and returns
+// the events in delivery order. Caller holds sseStateMu.
+func buildDeltas(changed, deleted []model.MapRecord) ([]sseEvent, error) {
+	var events []sseEvent
+	emit := func(event string, topics []string, build func(version uint64) interface{}) error {
+		e, err := newEvent(event, topics, build)
+		if err != nil {
+			return err
+		}
+		events = append(events, e)
+		return nil
+	}
+
+	if sseState.leaderboard == nil {
+		sseState.leaderboard = make(map[string]model.PlayerStats)
+	}
+
+	database := db.GetDB()
+
+	// records — 每個難度一個事件，讓 maps:<DIFF> 訂閱者只收到自己的難度
+	var difficulties []string
+	byDifficulty := make(map[string][]model.MapRecord)
+	for _, r := range changed {
+		if _, ok := byDifficulty[r.Difficulty]; !ok {
+			difficulties = append(difficulties, r.Difficulty)
+		}
+		byDifficulty[r.Difficulty] = append(byDifficulty[r.Difficulty], r)
+	}
+	for _, d := range difficulties {
+		records := byDifficulty[d]
+		topics := []string{}
+		for _, r := range records {
+			topics = append(topics, recordTopics(r)...)
+		}
+		if err := emit(eventRecordUpdated, topics, func(v uint64) interface{} {
+			return RecordUpdatedEvent{Version: v, Records: records}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// deleted records — 同樣依難度分組
+	difficulties = nil
+	deletedByDifficulty := make(map[string][]model.MapRecord)
+	for _, r := range deleted {
+		if _, ok := deletedByDifficulty[r.Difficulty]; !ok {
+			difficulties = append(difficulties, r.Difficulty)
+		}
+		deletedByDifficulty[r.Difficulty] = append(deletedByDifficulty[r.Difficulty], r)
+	}
+	for _, d := range difficulties {
+		topics := []string{}
+		ids := []uint{}
+		for _, r := range deletedByDifficulty[d] {
+			topics = append(topics, recordTopics(r)...)
+			ids = append(ids, r.ID)
+		}
+		if err := emit(eventRecordDeleted, topics, func(v uint64) interface{} {
+			return RecordDeletedEvent{Version: v, IDs: ids}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// growth（先於 summary 送出，讓客戶端通知能取得最新一筆）
+	var growth []model.GrowthData
+	if err := database.Where("id > ?", sseState.lastGrowthID).Order("id asc").Find(&growth).Error; err != nil {
+		return nil, err
+	}
+	if len(growth) > 0 {
+		milestones, err := buildMilestones()
+		if err != nil {
+			return nil, err
+		}
+		scoreMilestones, err := buildScoreMilestones()
+		if err != nil {
+			return nil, err
+		}
+		sseState.lastGrowthID = growth[len(growth)-1].ID
+		if err := emit(eventGrowthAppended, []string{topicGrowth}, func(v uint64) interface{} {
+			return GrowthAppendedEvent{Version: v, Growth: growth, Milestones: milestones, ScoreMilestones: scoreMilestones}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// progress
+	progress, err := buildProgress()
+	if err != nil {
+		return nil, err
+	}
+	progressJSON, _ := json.Marshal(progress)
+	if !bytes.Equal(progressJSON, sseState.progress) {
+		sseState.progress = progressJSON
+		if err := emit(eventProgressChanged, []string{topicProgress}, func(v uint64) interface{} {
+			return ProgressChangedEvent{Version: v, Progress: progress}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// leaderboard — only rows that differ from the last broadcast
+	leaderboard, _, err := leaderboardAt(DefaultLocation())
+	if err != nil {
+		return nil, err
+	}
+	changedRows := []model.PlayerStats{}
+	leaderboardTopics := []string{topicLeaderboard}
+	seen := make(map[string]bool, len(leaderboard))
+	for _, p := range leaderboard {
+		seen[p.Name] = true
+		if prev, ok := sseState.leaderboard[p.Name]; !ok || prev != p {
+			changedRows = append(changedRows, p)
+			leaderboardTopics = append(leaderboardTopics, playerTopic(p.Name))
+			sseState.leaderboard[p.Name] = p
+		}
+	}
+	removed := []string{}
+	for name := range sseState.leaderboard {
+		if !seen[name] {
+			removed = append(removed, name)
+			leaderboardTopics = append(leaderboardTopics, playerTopic(name))
+			delete(sseState.leaderboard, name)
+		}
+	}
+	if len(changedRows) > 0 || len(removed) > 0 {
+		if err := emit(eventLeaderboardChanged, leaderboardTopics, func(v uint64) interface{} {
+			return LeaderboardChangedEvent{Version: v, Changed: changedRows, Removed: removed}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// summary（LastUpdate 每次都會變，只比較數值欄位）
+	summary, err := latestSummary(database)
+	if err != nil {
+		return nil, err
+	}
+	prev := sseState.summary
+	if summary.CurrentScore != prev.CurrentScore || summary.CompletedMaps != prev.CompletedMaps ||
+		summary.TargetScore != prev.TargetScore || summary.TargetMaps != prev.TargetMaps {
+		sseState.summary = summary
+		if err := emit(eventSummaryChanged, []string{topicSummary}, func(v uint64) interface{} {
+			return SummaryChangedEvent{Version: v, Summary: summary}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return events, nil
+}
+
+// publish builds events under sseStateMu and delivers them to every subscribed client.
+func publish(build func() ([]sseEvent, error)) {
 	sseMu.RLock()
 	count := len(sseClients)
 	sseMu.RUnlock()
 
+	sseStateMu.Lock()
+	defer sseStateMu.Unlock()
+
 	if count == 0 {
+		// 沒有客戶端時不計算差異；跳過一個版本並清空重播緩衝，
+		// 之後帶 Last-Event-ID 重連的客戶端會改收完整快照。
+		// 差異基準已過期，下一個快照會重新建立（否則會重送快照已包含的 growth）
+		sseState.version++
+		sseState.initialized = false
+		sseHistory.reset()
 		return
 	}
 
-	data, err := collectAllData()
+	events, err := build()
 	if err != nil {
-		log.Println("SSE: failed to collect data:", err)
+		log.Println("SSE: failed to build events:", err)
 		return
 	}
 
-	payload, err := json.Marshal(data)
+	sseMu.RLock()
+	defer sseMu.RUnlock()
+	for c := range sseClients {
+		for _, e := range events {
+			if c.wants(e) {
+				c.deliver(e)
+			}
+		}
+	}
+}
+
+// buildMessageEvents encodes message.created events. Caller holds sseStateMu.
+func buildMessageEvents(messages []model.Message) ([]sseEvent, error) {
+	var events []sseEvent
+	for _, msg := range messages {
+		e, err := newEvent(eventMessageCreated, []string{topicMessages}, func(v uint64) interface{} {
+			return MessageCreatedEvent{Version: v, Message: msg}
+		})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func formatSSE(id uint64, event string, data []byte) []byte {
+	return []byte(fmt.Sprintf("id: %s\nevent: %s\ndata: %s\n\n", formatEventID(id), event, data))
+}
+
+// formatEventID 在版本前加上實例 epoch：各實例的版本各自計數，
+// 負載平衡後重連到其他實例時才能辨認出不是同一串事件
+func formatEventID(version uint64) string {
+	return instanceID + "-" + strconv.FormatUint(version, 10)
+}
+
+// lastEventID 讀取 Last-Event-ID header（瀏覽器自動重連時帶入），或 ?last_event_id= 參數；
+// epoch 不是本實例（或格式不符）時回傳 false，改送完整快照
+func lastEventID(c *gin.Context) (uint64, bool) {
+	raw := c.GetHeader("Last-Event-ID")
+	if raw == "" {
+		raw = c.Query("last_event_id")
+	}
+	epoch, seq, ok := strings.Cut(raw, "-")
+	if !ok || epoch != instanceID {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(seq, 10, 64)
 	if err != nil {
-		log.Println("SSE: failed to marshal data:", err)
-		return
+		return 0, false
 	}
+	return id, true
+}
 
-	msg := formatSSE("update", payload)
+// attachClient sends nothing itself: it registers the client and returns the
+// events to write first — missed events when Last-Event-ID is still in the
+// replay buffer, otherwise a full snapshot. Shared by SSE and WebSocket.
+// 快照失敗時不註冊（沒有基準的客戶端無法套用之後的差異事件），呼叫端應回覆 500。
+func attachClient(c *gin.Context, client *sseClient) ([]sseEvent, error) {
+	var initial []sseEvent
 
-	sseMu.RLock()
-	defer sseMu.RUnlock()
-	for c := range sseClients {
-		select {
-		case c.ch <- msg:
-		default:
-			// client too slow, skip
+	// 快照（或重播）與註冊需在同一把鎖內完成，確保不會漏掉之後的差異事件
+	sseStateMu.Lock()
+	replayed := false
+	if id, ok := lastEventID(c); ok {
+		if events, ok := sseHistory.since(id, sseState.version); ok {
+			for _, e := range events {
+				if client.wants(e) {
+					initial = append(initial, e)
+				}
+			}
+			replayed = true
 		}
 	}
+	if !replayed {
+		e, err := client.snapshot()
+		if err != nil {
+			sseStateMu.Unlock()
+			return nil, err
+		}
+		initial = append(initial, e)
+	}
+	sseMu.Lock()
+	sseClients[client] = struct{}{}
+	sseMu.Unlock()
+	sseStateMu.Unlock()
+
+	return initial, nil
 }
 
-func formatSSE(event string, data []byte) []byte {
-	return []byte(fmt.Sprintf("event: %s\ndata: %s\n\n", event, data))
+func detachClient(client *sseClient) {
+	sseMu.Lock()
+	delete(sseClients, client)
+	sseMu.Unlock()
+	close(client.ch)
 }
 
 // HandleSSE is the Gin handler for GET /api/sse
+// Query: topics（見 sse_topic.go，省略時訂閱全部）, last_event_id
 func HandleSSE(c *gin.Context) {
+	topics, err := parseTopics(c.Query("topics"))
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+
+	client := newSSEClient(topics)
+	initial, err := attachClient(c, client)
+	if err != nil {
+		respondError(c, internalError("SSE: failed to build snapshot", err))
+		return
+	}
+	defer detachClient(client)
+
 	c.Writer.Header().Set("Content-Type", "text/event-stream")
 	c.Writer.Header().Set("Cache-Control", "no-cache")
 	c.Writer.Header().Set("Connection", "keep-alive")
@@ -111,24 +608,22 @@ func HandleSSE(c *gin.Context) {
 	// Flush headers immediately
 	c.Writer.Flush()
 
-	client := &sseClient{ch: make(chan []byte, 8)}
-	sseMu.Lock()
-	sseClients[client] = struct{}{}
-	sseMu.Unlock()
-
-	defer func() {
-		sseMu.Lock()
-		delete(sseClients, client)
-		sseMu.Unlock()
-		close(client.ch)
-	}()
-
-	// Send initial full payload on connect
-	data, err := collectAllData()
-	if err == nil {
-		payload, _ := json.Marshal(data)
-		fmt.Fprintf(c.Writer, "event: update\ndata: %s\n\n", payload)
+	// 每次寫入都設定期限，避免卡住的連線永久佔用 goroutine
+	rc := http.NewResponseController(c.Writer)
+	write := func(msg []byte) error {
+		rc.SetWriteDeadline(time.Now().Add(sseStallTimeout))
+		if _, err := c.Writer.Write(msg); err != nil {
+			return err
+		}
 		c.Writer.Flush()
+		return nil
+	}
+
+	// Send initial full payload (or missed events) on connect
+	for _, e := range initial {
+		if err := write(formatSSE(e.id, e.event, e.payload)); err != nil {
+			return
+		}
 	}
 
 	// Stream loop
@@ -140,21 +635,106 @@ func HandleSSE(c *gin.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case msg, ok := <-client.ch:
+		case <-client.kick:
+			return
+		case <-client.resync:
+			e, err := client.resyncSnapshot()
+			if err != nil {
+				log.Println("SSE: failed to build resync snapshot:", err)
+				return
+			}
+			if err := write(formatSSE(e.id, e.event, e.payload)); err != nil {
+				return
+			}
+		case e, ok := <-client.ch:
 			if !ok {
 				return
 			}
-			_, err := c.Writer.Write(msg)
-			if err != nil {
+			if err := write(formatSSE(e.id, e.event, e.payload)); err != nil {
 				return
 			}
-			c.Writer.Flush()
 		case <-heartbeatTicker.C:
-			_, err := io.WriteString(c.Writer, ": heartbeat\n\n")
-			if err != nil {
+			if err := write([]byte(": heartbeat\n\n")); err != nil {
 				return
 			}
-			c.Writer.Flush()
 		}
 	}
 }
+
+// snapshot builds the client's (topic-filtered) full snapshot. Caller holds sseStateMu.
+func (c *sseClient) snapshot() (sseEvent, error) {
+	data, err := collectAllData()
+	if err != nil {
+		return sseEvent{}, err
+	}
+	if !sseState.initialized {
+		if err := seedHubState(data); err != nil {
+			return sseEvent{}, err
+		}
+	}
+	data["version"] = sseState.version
+	data["epoch"] = instanceID
+	filtered, err := c.filterSnapshot(data)
+	if err != nil {
+		return sseEvent{}, err
+	}
+	payload, err := json.Marshal(filtered)
+	if err != nil {
+		return sseEvent{}, err
+	}
+	return sseEvent{id: sseState.version, event: eventSnapshot, payload: payload}, nil
+}
+
+// resyncSnapshot discards the queued (stale) events and returns a fresh snapshot.
+// 在 sseStateMu 內清空佇列並解除停滯標記，之後的廣播版本必定大於快照版本。
+func (c *sseClient) resyncSnapshot() (sseEvent, error) {
+	sseStateMu.Lock()
+	defer sseStateMu.Unlock()
+
+	for drained := false; !drained; {
+		select {
+		case <-c.ch:
+		default:
+			drained = true
+		}
+	}
+
+	e, err := c.snapshot()
+	if err != nil {
+		return sseEvent{}, err
+	}
+	c.stalledSince.Store(0)
+	sseStats.resyncs.Add(1)
+	return e, nil
+}
+
+// SSEStats 為 GET /api/admin/sse-stats 的回傳內容
+type SSEStats struct {
+	Clients      int    `json:"clients"`
+	Stalled      int    `json:"stalled"`
+	Dropped      uint64 `json:"dropped"`
+	Coalesced    uint64 `json:"coalesced"`
+	Resyncs      uint64 `json:"resyncs"`
+	Disconnected uint64 `json:"disconnected"`
+}
+
+// GetSSEStats 回傳 SSE 連線數與慢速客戶端計數
+func GetSSEStats(c *gin.Context) {
+	stats := SSEStats{
+		Dropped:      sseStats.dropped.Load(),
+		Coalesced:    sseStats.coalesced.Load(),
+		Resyncs:      sseStats.resyncs.Load(),
+		Disconnected: sseStats.disconnected.Load(),
+	}
+
+	sseMu.RLock()
+	stats.Clients = len(sseClients)
+	for client := range sseClients {
+		if client.stalledSince.Load() != 0 {
+			stats.Stalled++
+		}
+	}
+	sseMu.RUnlock()
+
+	c.JSON(http.StatusOK, stats)
+}
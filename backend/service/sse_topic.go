@@ -0,0 +1,182 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"DDNETONE/db"
+	"DDNETONE/model"
+	"DDNETONE/utils"
+)
+
+// SSE topics — ?topics=summary,leaderboard,maps:BRUTAL,messages,player:<name>
+//
+//	summary            summary.changed
+//	progress           progress.changed
+//	growth             growth.appended（含 milestones）
+//	leaderboard        leaderboard.changed
+//	maps / maps:<DIFF> record.updated、record.deleted（全部或單一難度）
+//	messages           message.created
+//	presence           presence.changed
+//	player:<name>      該玩家參與的 record.updated、record.deleted、leaderboard.changed 與 presence.changed
+const (
+	topicSummary     = "summary"
+	topicProgress    = "progress"
+	topicGrowth      = "growth"
+	topicLeaderboard = "leaderboard"
+	topicMaps        = "maps"
+	topicMessages    = "messages"
+	topicPresence    = "presence"
+	topicPlayer      = "player"
+)
+
+// recentMessageLimit 為訂閱 messages 時快照內附帶的留言數量
+const recentMessageLimit = 100
+
+// parseTopics 解析 ?topics= 參數；空字串代表訂閱全部（回傳 nil）
+func parseTopics(raw string) (map[string]bool, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	topics := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, arg, hasArg := strings.Cut(part, ":")
+		switch name {
+		case topicSummary, topicProgress, topicGrowth, topicLeaderboard, topicMessages, topicPresence:
+			if hasArg {
+				return nil, fmt.Errorf("topic %q does not take an argument", name)
+			}
+			topics[name] = true
+		case topicMaps:
+			if hasArg && arg != "" && !strings.EqualFold(arg, "ALL") {
+				topics[mapsTopic(arg)] = true
+			} else {
+				topics[topicMaps] = true
+			}
+		case topicPlayer:
+			if arg == "" {
+				return nil, fmt.Errorf("topic %q requires a player name", name)
+			}
+			topics[playerTopic(arg)] = true
+		default:
+			return nil, fmt.Errorf("unknown topic %q", part)
+		}
+	}
+	if len(topics) == 0 {
+		return nil, nil
+	}
+	return topics, nil
+}
+
+func mapsTopic(difficulty string) string {
+	return topicMaps + ":" + strings.ToUpper(difficulty)
+}
+
+func playerTopic(name string) string {
+	return topicPlayer + ":" + name
+}
+
+// recordTopics 回傳一筆 MapRecord 事件所屬的 topics
+func recordTopics(r model.MapRecord) []string {
+	topics := []string{topicMaps, mapsTopic(r.Difficulty)}
+	for _, name := range utils.ParseRunnerNames(r.Runner) {
+		topics = append(topics, playerTopic(name))
+	}
+	return topics
+}
+
+// wants reports whether the client subscribed to any of the event's topics.
+func (c *sseClient) wants(e sseEvent) bool {
+	if c.topics == nil {
+		return true
+	}
+	for _, t := range e.topics {
+		if c.topics[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSnapshot 依訂閱內容裁剪完整快照；未指定 topics 時原樣回傳
+func (c *sseClient) filterSnapshot(data map[string]interface{}) (map[string]interface{}, error) {
+	if c.topics == nil {
+		return data, nil
+	}
+
+	out := map[string]interface{}{"version": data["version"], "epoch": data["epoch"]}
+	if c.topics[topicSummary] {
+		out["summary"] = data["summary"]
+	}
+	if c.topics[topicProgress] {
+		out["progress"] = data["progress"]
+	}
+	if c.topics[topicGrowth] {
+		out["growth"] = data["growth"]
+		out["milestones"] = data["milestones"]
+		out["score_milestones"] = data["score_milestones"]
+	}
+	if c.topics[topicMessages] {
+		messages := []model.Message{}
+		if err := db.GetDB().Order("created_at desc").Limit(recentMessageLimit).Find(&messages).Error; err != nil {
+			return nil, err
+		}
+		out["messages"] = messages
+	}
+
+	var players []string
+	for t := range c.topics {
+		if name, ok := strings.CutPrefix(t, topicPlayer+":"); ok {
+			players = append(players, name)
+		}
+	}
+
+	presence := data["presence"].([]model.Presence)
+	if c.topics[topicPresence] {
+		out["presence"] = presence
+	} else if len(players) > 0 {
+		rows := []model.Presence{}
+		for _, p := range presence {
+			if slices.Contains(players, p.Player) {
+				rows = append(rows, p)
+			}
+		}
+		out["presence"] = rows
+	}
+
+	leaderboard := data["leaderboard"].([]model.PlayerStats)
+	if c.topics[topicLeaderboard] {
+		out["leaderboard"] = leaderboard
+	} else if len(players) > 0 {
+		rows := []model.PlayerStats{}
+		for _, p := range leaderboard {
+			if slices.Contains(players, p.Name) {
+				rows = append(rows, p)
+			}
+		}
+		out["leaderboard"] = rows
+	}
+
+	maps := data["maps"].([]model.MapRecord)
+	if c.topics[topicMaps] {
+		out["maps"] = maps
+	} else {
+		var rows []model.MapRecord
+		for _, m := range maps {
+			if c.wants(sseEvent{topics: recordTopics(m)}) {
+				rows = append(rows, m)
+			}
+		}
+		if rows != nil {
+			out["maps"] = rows
+		}
+	}
+
+	return out, nil
+}
@@ -1,52 +1,181 @@
 package service
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
 	"DDNETONE/db"
 	"DDNETONE/model"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// GetSummary Handler
-func GetSummary(c *gin.Context) {
-	UpdateGlobalSummary() // 呼叫內部邏輯更新
-	var summary model.Summary
-	db.GetDB().Last(&summary)
+// Summary — 總覽只在寫入時（完成、還原、新增地圖）於同一交易內重新計算，
+// 每天一筆快照（Date 為 DefaultLocation 的日期），GET 只讀取最新一筆。
+
+const (
+	summaryDateLayout     = "2006-01-02"
+	defaultSummaryHistory = 30 // 天
+	maxSummaryHistory     = 366
+
+	// summaryLockKey 為 refreshSummary 使用的 advisory lock key
+	summaryLockKey = 0x646e6f31 // "dno1"
+)
 
+// GetSummary Handler（唯讀）
+func GetSummary(c *gin.Context) {
+	summary, err := latestSummary(db.GetDB())
+	if err != nil {
+		respondError(c, internalError("failed to load summary", err))
+		return
+	}
 	c.JSON(http.StatusOK, summary)
 }
 
-// UpdateGlobalSummary 更新全服總覽數據 (內部呼叫用)
-func UpdateGlobalSummary() {
-	var completedScore int64
-	var completedCount int64
-	var totalScore int64
-	var totalMaps int64
+// GetSummaryHistory 回傳每日總覽快照
+// Query: from, to (YYYY-MM-DD，預設最近 30 天)；沒有寫入的日子沿用前一天的數值。
+// 快照以 DefaultLocation 的日期儲存，無法改用其他時區切分，因此 tz 只接受伺服器時區
+func GetSummaryHistory(c *gin.Context) {
+	loc, err := resolveTimezone(c)
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+	if loc.String() != DefaultLocation().String() {
+		respondError(c, badRequest("tz must be "+DefaultLocation().String()+": summary snapshots are stored by server date"))
+		return
+	}
+	today := civilDay(time.Now(), loc)
+
+	to, err := parseSummaryDate(c.Query("to"), today)
+	if err != nil {
+		respondError(c, badRequest("invalid to: must be YYYY-MM-DD"))
+		return
+	}
+	from, err := parseSummaryDate(c.Query("from"), to.AddDate(0, 0, -(defaultSummaryHistory-1)))
+	if err != nil {
+		respondError(c, badRequest("invalid from: must be YYYY-MM-DD"))
+		return
+	}
+	if from.After(to) {
+		respondError(c, badRequest("from must not be after to"))
+		return
+	}
+	if to.Sub(from) >= maxSummaryHistory*24*time.Hour {
+		respondError(c, badRequest("date range must not exceed 366 days"))
+		return
+	}
 
 	database := db.GetDB()
+	fromKey, toKey := from.Format(summaryDateLayout), to.Format(summaryDateLayout)
 
-	database.Model(&model.MapRecord{}).Where("status = 2").Select("COALESCE(SUM(points), 0)").Scan(&completedScore)
-	database.Model(&model.MapRecord{}).Where("status = 2").Count(&completedCount)
-	database.Model(&model.MapRecord{}).Select("COALESCE(SUM(points), 0)").Scan(&totalScore)
-	database.Model(&model.MapRecord{}).Count(&totalMaps)
+	var rows []model.Summary
+	if err := database.Where("date >= ? AND date <= ?", fromKey, toKey).Order("date asc").Find(&rows).Error; err != nil {
+		respondError(c, internalError("failed to load summary history", err))
+		return
+	}
 
-	var summary model.Summary
-	if err := database.Last(&summary).Error; err != nil {
-		summary = model.Summary{
-			TargetScore: int(totalScore),
-			TargetMaps:  int(totalMaps),
+	// 區間開始前最後一筆，用來補齊開頭沒有快照的日子
+	var carry *model.Summary
+	var before model.Summary
+	err = database.Where("date < ?", fromKey).Order("date desc").First(&before).Error
+	if err == nil {
+		carry = &before
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		respondError(c, internalError("failed to load summary history", err))
+		return
+	}
+
+	byDate := make(map[string]model.Summary, len(rows))
+	for _, r := range rows {
+		byDate[r.Date] = r
+	}
+
+	history := []model.Summary{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		key := d.Format(summaryDateLayout)
+		if r, ok := byDate[key]; ok {
+			carry = &r
+		} else if carry == nil || d.After(today) {
+			continue
 		}
-		database.Create(&summary)
+		s := *carry
+		s.Date = key
+		history = append(history, s)
 	}
 
-	summary.CurrentScore = int(completedScore)
-	summary.CompletedMaps = int(completedCount)
-	summary.TargetScore = int(totalScore)
-	summary.TargetMaps = int(totalMaps)
-	summary.LastUpdate = time.Now()
+	c.JSON(http.StatusOK, history)
+}
+
+func parseSummaryDate(raw string, fallback time.Time) (time.Time, error) {
+	if raw == "" {
+		return fallback, nil
+	}
+	return time.Parse(summaryDateLayout, raw)
+}
 
-	database.Save(&summary)
+// latestSummary 讀取最新一筆快照；尚未有任何快照時回傳零值
+func latestSummary(database *gorm.DB) (model.Summary, error) {
+	var summary model.Summary
+	err := database.Order("date desc").First(&summary).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.Summary{}, nil
+	}
+	return summary, err
+}
 
+// refreshSummary 在 tx 內重新計算總覽並寫入今天的快照（同一天覆寫）；
+// retired 的地圖不在目標內，完成數與分數也不計入，避免超過目標。
+// 先取得 transaction-level advisory lock 讓並行的交易依序計算：READ COMMITTED 下
+// 統計語句在取得鎖之後才開始，因此會看到前一個交易已 commit 的變更，不會互相覆寫
+func refreshSummary(tx *gorm.DB) (model.Summary, error) {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", summaryLockKey).Error; err != nil {
+		return model.Summary{}, err
+	}
+
+	var totals struct {
+		CurrentScore  int
+		CompletedMaps int
+		TargetScore   int
+		TargetMaps    int
+	}
+	err := tx.Model(&model.MapRecord{}).
+		Where("NOT retired").
+		Select(`COALESCE(SUM(points) FILTER (WHERE status IN ?), 0) AS current_score,
+			COUNT(*) FILTER (WHERE status IN ?) AS completed_maps,
+			COALESCE(SUM(points), 0) AS target_score,
+			COUNT(*) AS target_maps`, model.CompletedStatuses, model.CompletedStatuses).
+		Scan(&totals).Error
+	if err != nil {
+		return model.Summary{}, err
+	}
+
+	now := time.Now()
+	summary := model.Summary{
+		Date:          now.In(DefaultLocation()).Format(summaryDateLayout),
+		CurrentScore:  totals.CurrentScore,
+		CompletedMaps: totals.CompletedMaps,
+		TargetScore:   totals.TargetScore,
+		TargetMaps:    totals.TargetMaps,
+		LastUpdate:    now,
+	}
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"current_score", "completed_maps", "target_score", "target_maps", "last_update"}),
+	}).Create(&summary).Error
+	return summary, err
+}
+
+// UpdateGlobalSummary 更新全服總覽數據（啟動時或不在交易內的寫入使用）
+func UpdateGlobalSummary() {
+	err := db.GetDB().Transaction(func(tx *gorm.DB) error {
+		_, err := refreshSummary(tx)
+		return err
+	})
+	if err != nil {
+		log.Println("Summary: failed to refresh:", err)
+	}
 }
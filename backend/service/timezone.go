@@ -0,0 +1,61 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fallbackTimezone 為未設定 APP_TIMEZONE / DB_TIMEZONE 時的預設時區
+const fallbackTimezone = "Asia/Taipei"
+
+var (
+	defaultLocation     *time.Location
+	defaultLocationOnce sync.Once
+)
+
+// DefaultLocation 回傳伺服器預設時區：APP_TIMEZONE > DB_TIMEZONE > Asia/Taipei
+func DefaultLocation() *time.Location {
+	defaultLocationOnce.Do(func() {
+		for _, key := range []string{"APP_TIMEZONE", "DB_TIMEZONE"} {
+			name := os.Getenv(key)
+			if name == "" {
+				continue
+			}
+			loc, err := time.LoadLocation(name)
+			if err != nil {
+				log.Printf("Ignoring invalid %s=%q: %v", key, name, err)
+				continue
+			}
+			defaultLocation = loc
+			return
+		}
+		loc, err := time.LoadLocation(fallbackTimezone)
+		if err != nil {
+			loc = time.UTC
+		}
+		defaultLocation = loc
+	})
+	return defaultLocation
+}
+
+// resolveTimezone 解析 ?tz= 參數（IANA 時區名稱），未帶參數時使用伺服器預設
+func resolveTimezone(c *gin.Context) (*time.Location, error) {
+	name := c.Query("tz")
+	if name == "" {
+		return DefaultLocation(), nil
+	}
+	// time.LoadLocation 接受 "" 與 "Local"，但這兩者不是合法的 IANA 名稱
+	if name == "Local" {
+		return nil, fmt.Errorf("invalid tz %q: must be an IANA zone name such as Asia/Taipei", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz %q: must be an IANA zone name such as Asia/Taipei", name)
+	}
+	return loc, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"DDNETONE/model"
+	"DDNETONE/utils"
+)
+
+// Input validation — request body 以 binding tag 驗證（gin 內建的 validator），
+// 另外註冊兩個自訂規則：
+//
+//	difficulty  必須是 model.Difficulties 之一
+//	runners     以 , 或 & 分隔的每位 runner 名稱不超過 maxRunnerNameLength
+//
+// WebSocket frame 以 decodeJSON 套用相同的規則。
+
+// maxRunnerNameLength 為單一 runner 名稱的長度上限
+const maxRunnerNameLength = 32
+
+var (
+	difficultyMessage = "must be one of " + strings.Join(model.Difficulties, ", ")
+	runnersMessage    = fmt.Sprintf("each runner name must be at most %d characters", maxRunnerNameLength)
+)
+
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	// 驗證錯誤的欄位名稱使用 json tag（而非 Go 欄位名稱）
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	v.RegisterValidation("difficulty", func(fl validator.FieldLevel) bool {
+		return model.IsKnownDifficulty(fl.Field().String())
+	})
+	v.RegisterValidation("runners", func(fl validator.FieldLevel) bool {
+		return validRunners(fl.Field().String())
+	})
+}
+
+// validRunners 檢查每位 runner 名稱的長度（整體長度由 max tag 限制）
+func validRunners(runner string) bool {
+	for _, name := range utils.ParseRunnerNames(runner) {
+		if utf8.RuneCountInString(name) > maxRunnerNameLength {
+			return false
+		}
+	}
+	return true
+}
+
+// bindJSON 解析並驗證 request body
+func bindJSON(c *gin.Context, obj interface{}) error {
+	return bindingError(c.ShouldBindJSON(obj))
+}
+
+// decodeJSON 以與 bindJSON 相同的規則解析並驗證 WebSocket frame 的 data
+func decodeJSON(data json.RawMessage, obj interface{}) error {
+	if len(data) == 0 {
+		return bindingError(io.EOF)
+	}
+	if err := json.Unmarshal(data, obj); err != nil {
+		return bindingError(err)
+	}
+	return bindingError(binding.Validator.ValidateStruct(obj))
+}
+
+// bindingError 將解析/驗證錯誤轉為 validation_failed（不外洩 binder 內部訊息）
+func bindingError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var verrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &verrs):
+		details := make([]FieldError, 0, len(verrs))
+		for _, fe := range verrs {
+			details = append(details, FieldError{Field: fe.Field(), Message: validationMessage(fe)})
+		}
+		return validationFailed(details...)
+	case errors.As(err, &typeErr):
+		return validationFailed(FieldError{Field: typeErr.Field, Message: "must be " + jsonTypeName(typeErr.Type)})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return badRequest("malformed JSON body")
+	case errors.Is(err, io.EOF):
+		return badRequest("request body is required")
+	default:
+		return badRequest("invalid request body")
+	}
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		switch fe.Kind() {
+		case reflect.String:
+			return "must be at least " + fe.Param() + " characters"
+		case reflect.Slice:
+			return "must contain at least " + fe.Param() + " items"
+		}
+		return "must be at least " + fe.Param()
+	case "max", "lte":
+		switch fe.Kind() {
+		case reflect.String:
+			return "must be at most " + fe.Param() + " characters"
+		case reflect.Slice:
+			return "must contain at most " + fe.Param() + " items"
+		}
+		return "must be at most " + fe.Param()
+	case "oneof":
+		return "must be one of " + fe.Param()
+	case "required_if":
+		return "is required for this action"
+	case "unique":
+		return "must not contain duplicates"
+	case "difficulty":
+		return difficultyMessage
+	case "runners":
+		return runnersMessage
+	default:
+		return "is invalid (" + fe.Tag() + ")"
+	}
+}
+
+// jsonTypeName 回傳 JSON 型別名稱（含冠詞）
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	default:
+		return "a string"
+	}
+}
+
+// pathID 解析路徑中的 :id，必須是正整數
+func pathID(c *gin.Context) (uint, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		return 0, badRequest("id must be a positive integer")
+	}
+	return uint(id), nil
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"DDNETONE/model"
+)
+
+// WebSocket — same events as /api/sse (shares the hub's client registry,
+// topics and Last-Event-ID replay) plus client → server actions.
+//
+// Server → client frame: {"id": 42, "event": "summary.changed", "data": {...}}
+// Client → server frame: {"action": "message.post", "request_id": "1", "data": {...}}
+// 每個 action 都會回覆 ack（成功）或 error 事件，並帶回 request_id。
+
+const wsMaxMessageSize = 64 * 1024
+
+// wsPongWait 超過兩次 heartbeat 沒有任何回應即視為斷線
+var wsPongWait = 2 * sseHeartbeat
+
+var wsUpgrader = websocket.Upgrader{
+	// 與 CORS 設定一致（AllowAllOrigins）
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type wsFrame struct {
+	ID    string          `json:"id,omitempty"` // 同 SSE 的事件 ID（"<epoch>-<version>"）
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+type wsAction struct {
+	Action    string          `json:"action"`
+	RequestID string          `json:"request_id"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// wsAck 的 code/error/details 與 REST 的錯誤格式相同
+type wsAck struct {
+	RequestID string       `json:"request_id"`
+	Action    string       `json:"action"`
+	Result    interface{}  `json:"result,omitempty"`
+	Code      string       `json:"code,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Details   []FieldError `json:"details,omitempty"`
+}
+
+// wsActions 為可用的 client → server 動作
+var wsActions = map[string]func(data json.RawMessage) (interface{}, error){
+	"message.post": wsPostMessage,
+	"map.claim":    wsClaimMap,
+	"presence.set": wsSetPresence,
+	"heartbeat":    wsHeartbeat,
+}
+
+// wsConn serialises writes: the stream loop and action replies share one connection.
+type wsConn struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+}
+
+func (w *wsConn) writeJSON(v interface{}) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.conn.SetWriteDeadline(time.Now().Add(sseStallTimeout))
+	return w.conn.WriteJSON(v)
+}
+
+func (w *wsConn) writeEvent(e sseEvent) error {
+	return w.writeJSON(wsFrame{ID: formatEventID(e.id), Event: e.event, Data: e.payload})
+}
+
+func (w *wsConn) ping() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(sseStallTimeout))
+}
+
+// HandleWS is the Gin handler for GET /api/ws
+// Query: topics, last_event_id（同 /api/sse）
+func HandleWS(c *gin.Context) {
+	topics, err := parseTopics(c.Query("topics"))
+	if err != nil {
+		respondError(c, badRequest(err.Error()))
+		return
+	}
+
+	// 先建立快照再升級，快照失敗時仍能以 HTTP 500 回覆
+	client := newSSEClient(topics)
+	initial, err := attachClient(c, client)
+	if err != nil {
+		respondError(c, internalError("WS: failed to build snapshot", err))
+		return
+	}
+	defer detachClient(client)
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade 已回覆 HTTP 錯誤
+		return
+	}
+	ws := &wsConn{conn: conn}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ws.readLoop()
+	}()
+
+	for _, e := range initial {
+		if err := ws.writeEvent(e); err != nil {
+			return
+		}
+	}
+
+	heartbeatTicker := time.NewTicker(sseHeartbeat)
+	defer heartbeatTicker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-client.kick:
+			return
+		case <-client.resync:
+			e, err := client.resyncSnapshot()
+			if err != nil {
+				log.Println("WS: failed to build resync snapshot:", err)
+				return
+			}
+			if err := ws.writeEvent(e); err != nil {
+				return
+			}
+		case e, ok := <-client.ch:
+			if !ok {
+				return
+			}
+			if err := ws.writeEvent(e); err != nil {
+				return
+			}
+		case <-heartbeatTicker.C:
+			if err := ws.ping(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readLoop handles client actions until the connection closes.
+func (w *wsConn) readLoop() {
+	w.conn.SetReadLimit(wsMaxMessageSize)
+	w.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	w.conn.SetPongHandler(func(string) error {
+		return w.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, raw, err := w.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		w.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		var action wsAction
+		if err := json.Unmarshal(raw, &action); err != nil {
+			w.reply("error", wsAck{Code: CodeBadRequest, Error: "invalid JSON frame"})
+			continue
+		}
+
+		ack := wsAck{RequestID: action.RequestID, Action: action.Action}
+		handler, ok := wsActions[action.Action]
+		if !ok {
+			ack.Code = CodeBadRequest
+			ack.Error = fmt.Sprintf("unknown action %q", action.Action)
+			w.reply("error", ack)
+			continue
+		}
+
+		result, err := handler(action.Data)
+		if err != nil {
+			apiErr := toAPIError(err)
+			ack.Code, ack.Error, ack.Details = apiErr.Code, apiErr.Message, apiErr.Details
+			w.reply("error", ack)
+			continue
+		}
+		ack.Result = result
+		w.reply("ack", ack)
+	}
+}
+
+func (w *wsConn) reply(event string, ack wsAck) {
+	data, err := json.Marshal(ack)
+	if err != nil {
+		return
+	}
+	w.writeJSON(wsFrame{Event: event, Data: data})
+}
+
+func wsPostMessage(data json.RawMessage) (interface{}, error) {
+	var req PostMessageRequest
+	if err := decodeJSON(data, &req); err != nil {
+		return nil, err
+	}
+	msg := model.Message{User: req.User, Content: req.Content}
+	if err := postMessage(&msg); err != nil {
+		return nil, internalError("failed to post message", err)
+	}
+	return msg, nil
+}
+
+func wsClaimMap(data json.RawMessage) (interface{}, error) {
+	var req ClaimMapRequest
+	if err := decodeJSON(data, &req); err != nil {
+		return nil, err
+	}
+	return claimMap(req)
+}
+
+func wsSetPresence(data json.RawMessage) (interface{}, error) {
+	var req SetPresenceRequest
+	if err := decodeJSON(data, &req); err != nil {
+		return nil, err
+	}
+
+	resp, err := setPresence(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// wsHeartbeat 帶 player 時同時續約該玩家的 presence
+func wsHeartbeat(data json.RawMessage) (interface{}, error) {
+	var req struct {
+		Player string `json:"player"`
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			return nil, bindingError(err)
+		}
+	}
+
+	result := gin.H{"server_time": time.Now()}
+	if req.Player != "" {
+		presence, err := renewPresence(req.Player)
+		if errors.Is(err, errPresenceNotFound) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, internalError("failed to renew presence", err)
+		}
+		result["presence"] = presence
+	}
+	return result, nil
+}
@@ -9,6 +9,10 @@ export function useGameData(toastRef = null) {
   const growthData = ref([]);
   const milestonesData = ref([]);
   const scoreMilestonesData = ref([]);
+  const progress = ref([]);
+  const presence = ref([]);
+  let version = 0; // 最後套用的 SSE 事件版本
+  let epoch = ''; // 快照來源實例；重連時與版本一起帶回（"<epoch>-<version>"）
   let prevCompletedMaps = -1;
   let prevScore = -1;
   let prevLoadedMaps = -1;
@@ -34,22 +38,14 @@ export function useGameData(toastRef = null) {
     growthData.value = Array.from({ length: 12 }, (_, i) => ({ hours: i * 2, points: 1000 + Math.random() * 5000 + (i * 1000) }));
   };
 
-  // 處理從 SSE 或 REST 拿到的資料更新
-  const applyUpdate = (data) => {
-    summary.value = data.summary;
-    players.value = data.leaderboard;
-    maps.value = data.maps;
-    growthData.value = data.growth;
-    milestonesData.value = data.milestones;
-    scoreMilestonesData.value = data.score_milestones;
-
-    // Toast 通知邏輯
-    const newMaps = data.summary.completed_maps;
-    const newScore = data.summary.current_score;
-    const newLoadedMaps = data.summary.loaded_maps ?? 0;
+  // Toast 通知邏輯（summary 更新時呼叫）
+  const notifySummary = (newSummary) => {
+    const newMaps = newSummary.completed_maps;
+    const newScore = newSummary.current_score;
+    const newLoadedMaps = newSummary.loaded_maps ?? 0;
+    const latestGrowth = growthData.value[growthData.value.length - 1];
 
     if (prevCompletedMaps >= 0 && newMaps > prevCompletedMaps && toastRef?.value) {
-      const latestGrowth = data.growth[data.growth.length - 1];
       toastRef.value.addToast({
         type: 'success',
         title: latestGrowth?.map_name
@@ -61,7 +57,6 @@ export function useGameData(toastRef = null) {
       });
     }
     if (prevLoadedMaps >= 0 && newLoadedMaps > prevLoadedMaps && toastRef?.value) {
-      const latestGrowth = data.growth[data.growth.length - 1];
       toastRef.value.addToast({
         type: 'info',
         title: latestGrowth?.map_name ? `LOADED: ${latestGrowth.map_name}` : 'MAP LOADED',
@@ -75,13 +70,73 @@ export function useGameData(toastRef = null) {
     prevLoadedMaps = newLoadedMaps;
   };
 
+  // 處理從 SSE 快照或 REST 拿到的完整資料
+  const applyUpdate = (data) => {
+    players.value = data.leaderboard;
+    maps.value = data.maps;
+    growthData.value = data.growth;
+    milestonesData.value = data.milestones;
+    scoreMilestonesData.value = data.score_milestones;
+    if (data.progress) progress.value = data.progress;
+    if (data.presence) presence.value = data.presence;
+    if (data.version != null) version = data.version;
+    if (data.epoch) epoch = data.epoch;
+
+    summary.value = data.summary;
+    notifySummary(data.summary);
+  };
+
+  // SSE 差異事件
+  const deltaHandlers = {
+    'record.updated': ({ records }) => {
+      const byId = new Map(records.map(r => [r.id, r]));
+      const next = maps.value.map(m => byId.get(m.id) ?? m);
+      for (const r of records) {
+        if (!maps.value.some(m => m.id === r.id)) next.push(r);
+      }
+      next.sort((a, b) => b.score - a.score);
+      maps.value = next;
+    },
+    'record.deleted': ({ ids }) => {
+      const removed = new Set(ids);
+      maps.value = maps.value.filter(m => !removed.has(m.id));
+    },
+    'growth.appended': ({ growth, milestones, score_milestones }) => {
+      const since = Date.now() - 7 * 24 * 60 * 60 * 1000;
+      // 快照與差異可能包含同一筆（快照建立時尚未廣播的寫入），以 id 去重
+      const seen = new Set(growthData.value.map(d => d.id));
+      growthData.value = [...growthData.value, ...growth.filter(d => !seen.has(d.id))]
+        .filter(d => new Date(d.timestamp).getTime() >= since);
+      milestonesData.value = milestones;
+      scoreMilestonesData.value = score_milestones;
+    },
+    'progress.changed': (data) => {
+      progress.value = data.progress;
+    },
+    'leaderboard.changed': ({ changed, removed }) => {
+      const byName = new Map(players.value.map(p => [p.name, p]));
+      for (const name of removed) byName.delete(name);
+      for (const p of changed) byName.set(p.name, p);
+      players.value = [...byName.values()].sort((a, b) => b.score_contrib - a.score_contrib);
+    },
+    'summary.changed': (data) => {
+      summary.value = data.summary;
+      notifySummary(data.summary);
+    },
+    'presence.changed': (data) => {
+      presence.value = data.presence;
+    },
+    // 留言板另外訂閱；這裡只需推進版本號
+    'message.created': () => {}
+  };
+
   // Fallback: 用 REST API 一次取全部資料
   const fetchData = async () => {
     try {
       const [sumRes, playRes, mapRes, growthRes, milestonesRes, scoreMilestonesRes] = await Promise.all([
         axios.get(`/api/summary`),
         axios.get(`/api/leaderboard`),
-        axios.get(`/api/maps`),
+        axios.get(`/api/maps?paginate=false`),
         axios.get(`/api/growth`),
         axios.get(`/api/milestones`),
         axios.get(`/api/score-milestones`)
@@ -105,12 +160,15 @@ export function useGameData(toastRef = null) {
   let eventSource = null;
   let reconnectTimer = null;
 
-  const connectSSE = () => {
+  // resume=true 時帶上最後的事件 ID，讓伺服器只重播漏掉的事件
+  const connectSSE = (resume = false) => {
     if (eventSource) {
       eventSource.close();
     }
 
-    eventSource = new EventSource('/api/sse');
+    eventSource = new EventSource(resume && epoch && version
+      ? `/api/sse?last_event_id=${encodeURIComponent(`${epoch}-${version}`)}`
+      : '/api/sse');
 
     eventSource.addEventListener('update', (e) => {
       try {
@@ -121,13 +179,31 @@ export function useGameData(toastRef = null) {
       }
     });
 
+    for (const [event, handler] of Object.entries(deltaHandlers)) {
+      eventSource.addEventListener(event, (e) => {
+        try {
+          const data = JSON.parse(e.data);
+          if (data.version !== version + 1) {
+            // 版本不連續代表漏掉事件，重新連線以取得完整快照
+            console.warn(`SSE version gap (${version} -> ${data.version})，重新同步`);
+            connectSSE();
+            return;
+          }
+          version = data.version;
+          handler(data);
+        } catch (err) {
+          console.warn('SSE parse error:', err);
+        }
+      });
+    }
+
     eventSource.onerror = () => {
       // EventSource 會自動重連，但若完全斷線則 fallback 到 REST
       if (eventSource.readyState === EventSource.CLOSED) {
         console.warn('SSE 連線關閉，將在 5 秒後重試');
         eventSource.close();
         eventSource = null;
-        reconnectTimer = setTimeout(connectSSE, 5000);
+        reconnectTimer = setTimeout(() => connectSSE(true), 5000);
       }
     };
   };
@@ -192,6 +268,8 @@ export function useGameData(toastRef = null) {
     growthData,
     milestonesData,
     scoreMilestonesData,
+    progress,
+    presence,
     progressPercent,
     chartData,
     fetchData